@@ -0,0 +1,221 @@
+package arc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tokenized/arc/pkg/tef"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrMissingAncestors    = errors.New("Missing Ancestors")
+	ErrWrongAncestor       = errors.New("Wrong Ancestor")
+	ErrAncestorOutputIndex = errors.New("Ancestor Output Index Out Of Range")
+)
+
+// AncestorProvider provides the parent txs needed to convert raw txs to expanded txs so they can
+// be submitted in the extended format. There is only a batch lookup, single txs are requested
+// through GetTxs with one txid.
+type AncestorProvider interface {
+	// GetTxs returns the txs with the txids in the same order. Txs that aren't found are nil.
+	GetTxs(ctx context.Context, txids []bitcoin.Hash32) ([]*wire.MsgTx, error)
+}
+
+// AncestorMap is an in-memory AncestorProvider.
+type AncestorMap map[bitcoin.Hash32]*wire.MsgTx
+
+// MissingAncestorsError is returned when parent txs aren't found by the ancestor provider.
+type MissingAncestorsError struct {
+	// TxIDs are the txids of the parent txs that weren't found.
+	TxIDs []bitcoin.Hash32
+
+	// Inputs are the inputs that spend outputs of the missing parent txs.
+	Inputs []MissingAncestorInput
+}
+
+// MissingAncestorInput is an input that spends an output of a parent tx that wasn't found.
+type MissingAncestorInput struct {
+	// TxIndex is the index of the tx within the txs being expanded.
+	TxIndex int
+
+	tef.MissingInput
+}
+
+// ExpandTx returns an expanded tx containing the parents of the raw tx, and the outputs spent by
+// its inputs, so it can be submitted in the extended format. The parents are requested from the
+// provider in one batch. A MissingAncestorsError is returned when any parents aren't found.
+func ExpandTx(ctx context.Context, provider AncestorProvider,
+	tx *wire.MsgTx) (*expanded_tx.ExpandedTx, error) {
+
+	etxs, err := ExpandTxs(ctx, provider, []*wire.MsgTx{tx})
+	if err != nil {
+		return nil, err
+	}
+
+	return etxs[0], nil
+}
+
+// ExpandTxs returns expanded txs for the raw txs with one batched request to the provider. Parents
+// that are also in txs don't need to be provided so chains of unsubmitted txs can be expanded.
+func ExpandTxs(ctx context.Context, provider AncestorProvider,
+	txs []*wire.MsgTx) ([]*expanded_tx.ExpandedTx, error) {
+
+	parents := make(map[bitcoin.Hash32]*wire.MsgTx)
+	for _, tx := range txs {
+		parents[*tx.TxHash()] = tx
+	}
+
+	var requestTxIDs []bitcoin.Hash32
+	requested := make(map[bitcoin.Hash32]bool)
+	for _, tx := range txs {
+		for _, input := range tx.TxIn {
+			hash := input.PreviousOutPoint.Hash
+			if hash.IsZero() { // coinbase input
+				continue
+			}
+
+			if _, exists := parents[hash]; exists || requested[hash] {
+				continue
+			}
+
+			requested[hash] = true
+			requestTxIDs = append(requestTxIDs, hash)
+		}
+	}
+
+	if len(requestTxIDs) > 0 {
+		providedTxs, err := provider.GetTxs(ctx, requestTxIDs)
+		if err != nil {
+			return nil, errors.Wrap(err, "get txs")
+		}
+
+		if len(providedTxs) != len(requestTxIDs) {
+			return nil, errors.Wrapf(ErrWrongAncestor, "count %d, want %d", len(providedTxs),
+				len(requestTxIDs))
+		}
+
+		for i, providedTx := range providedTxs {
+			if providedTx == nil {
+				continue
+			}
+
+			if txid := providedTx.TxHash(); !txid.Equal(&requestTxIDs[i]) {
+				return nil, errors.Wrapf(ErrWrongAncestor, "got %s, want %s", txid,
+					requestTxIDs[i])
+			}
+
+			parents[requestTxIDs[i]] = providedTx
+		}
+	}
+
+	missing := &MissingAncestorsError{}
+	var result []*expanded_tx.ExpandedTx
+	for txIndex, tx := range txs {
+		etx := &expanded_tx.ExpandedTx{
+			Tx:           tx,
+			SpentOutputs: make(expanded_tx.Outputs, len(tx.TxIn)),
+		}
+		added := make(map[bitcoin.Hash32]bool)
+
+		for inputIndex, input := range tx.TxIn {
+			outpoint := input.PreviousOutPoint
+			if outpoint.Hash.IsZero() { // coinbase input
+				continue
+			}
+
+			parent, exists := parents[outpoint.Hash]
+			if !exists {
+				missing.add(txIndex, inputIndex, outpoint)
+				continue
+			}
+
+			if outpoint.Index >= uint32(len(parent.TxOut)) {
+				return nil, errors.Wrapf(ErrAncestorOutputIndex, "tx %d input %d: %s", txIndex,
+					inputIndex, outpoint)
+			}
+
+			if !added[outpoint.Hash] {
+				added[outpoint.Hash] = true
+				etx.Ancestors = append(etx.Ancestors, &expanded_tx.AncestorTx{
+					Tx: parent,
+				})
+			}
+
+			output := parent.TxOut[outpoint.Index]
+			etx.SpentOutputs[inputIndex] = &expanded_tx.Output{
+				Value:         output.Value,
+				LockingScript: output.LockingScript,
+			}
+		}
+
+		result = append(result, etx)
+	}
+
+	if len(missing.Inputs) > 0 {
+		return nil, *missing
+	}
+
+	return result, nil
+}
+
+func (m AncestorMap) Add(txs ...*wire.MsgTx) {
+	for _, tx := range txs {
+		m[*tx.TxHash()] = tx
+	}
+}
+
+func (m AncestorMap) GetTxs(ctx context.Context,
+	txids []bitcoin.Hash32) ([]*wire.MsgTx, error) {
+
+	result := make([]*wire.MsgTx, len(txids))
+	for i, txid := range txids {
+		result[i] = m[txid]
+	}
+
+	return result, nil
+}
+
+func (err *MissingAncestorsError) add(txIndex, inputIndex int, outpoint wire.OutPoint) {
+	err.Inputs = append(err.Inputs, MissingAncestorInput{
+		TxIndex: txIndex,
+		MissingInput: tef.MissingInput{
+			Index:    inputIndex,
+			OutPoint: outpoint,
+		},
+	})
+
+	for _, txid := range err.TxIDs {
+		if txid.Equal(&outpoint.Hash) {
+			return
+		}
+	}
+
+	err.TxIDs = append(err.TxIDs, outpoint.Hash)
+}
+
+func (err MissingAncestorsError) Error() string {
+	txids := make([]string, len(err.TxIDs))
+	for i, txid := range err.TxIDs {
+		txids[i] = txid.String()
+	}
+
+	inputs := make([]string, len(err.Inputs))
+	for i, input := range err.Inputs {
+		inputs[i] = fmt.Sprintf("tx %d input %d (%s)", input.TxIndex, input.Index,
+			input.OutPoint)
+	}
+
+	return fmt.Sprintf("%s : %s : %s", ErrMissingAncestors, strings.Join(txids, ", "),
+		strings.Join(inputs, ", "))
+}
+
+// Is makes errors.Is(err, ErrMissingAncestors) true for a MissingAncestorsError.
+func (err MissingAncestorsError) Is(target error) bool {
+	return target == ErrMissingAncestors
+}
@@ -0,0 +1,163 @@
+package arc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/tokenized/arc/internal/txtest"
+	"github.com/tokenized/arc/pkg/tef"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+type countingAncestorProvider struct {
+	AncestorMap
+	calls int
+}
+
+func (p *countingAncestorProvider) GetTxs(ctx context.Context,
+	txids []bitcoin.Hash32) ([]*wire.MsgTx, error) {
+
+	p.calls++
+	return p.AncestorMap.GetTxs(ctx, txids)
+}
+
+func Test_ExpandTx(t *testing.T) {
+	ctx := context.Background()
+
+	parent1 := txtest.NewTx(nil, 1000, 1001)
+	parent2 := txtest.NewTx(nil, 1000)
+	tx := txtest.NewTx([]*wire.MsgTx{parent1, parent2, parent1}, 1000)
+	tx.TxIn[2].PreviousOutPoint.Index = 1
+
+	provider := &countingAncestorProvider{AncestorMap: make(AncestorMap)}
+	provider.Add(parent1, parent2)
+
+	etx, err := ExpandTx(ctx, provider, tx)
+	if err != nil {
+		t.Fatalf("Failed to expand tx : %s", err)
+	}
+
+	if provider.calls != 1 {
+		t.Fatalf("Wrong provider call count : got %d, want %d", provider.calls, 1)
+	}
+
+	if len(etx.Ancestors) != 2 {
+		t.Fatalf("Wrong ancestor count : got %d, want %d", len(etx.Ancestors), 2)
+	}
+
+	wantValues := []uint64{1000, 1000, 1001}
+	for index, wantValue := range wantValues {
+		output, err := etx.InputOutput(index)
+		if err != nil {
+			t.Fatalf("Failed to get input output %d : %s", index, err)
+		}
+
+		if output.Value != wantValue {
+			t.Fatalf("Wrong input output %d value : got %d, want %d", index, output.Value,
+				wantValue)
+		}
+	}
+
+	// The expanded tx is ready for the extended format.
+	buf := &bytes.Buffer{}
+	if err := tef.Serialize(buf, etx); err != nil {
+		t.Fatalf("Failed to serialize extended format : %s", err)
+	}
+}
+
+func Test_ExpandTxs_Chain(t *testing.T) {
+	ctx := context.Background()
+
+	parent := txtest.NewTx(nil, 1000)
+	child := txtest.NewTx([]*wire.MsgTx{parent}, 1000)
+	grandChild := txtest.NewTx([]*wire.MsgTx{child}, 1000)
+
+	provider := make(AncestorMap)
+	provider.Add(parent)
+
+	// The child is in the batch so it isn't requested from the provider.
+	etxs, err := ExpandTxs(ctx, provider, []*wire.MsgTx{child, grandChild})
+	if err != nil {
+		t.Fatalf("Failed to expand txs : %s", err)
+	}
+
+	childTxID := *child.TxHash()
+	if etxs[1].Ancestors.GetTx(childTxID) == nil {
+		t.Fatalf("Grand child should have child ancestor")
+	}
+
+	if len(tef.MissingInputs(etxs[1])) != 0 {
+		t.Fatalf("Grand child should have all spent outputs")
+	}
+}
+
+func Test_ExpandTxs_MissingAncestors(t *testing.T) {
+	ctx := context.Background()
+
+	parent := txtest.NewTx(nil, 1000)
+	missingParent1 := txtest.NewTx(nil, 1000)
+	missingParent2 := txtest.NewTx(nil, 1000)
+	tx1 := txtest.NewTx([]*wire.MsgTx{parent, missingParent1}, 1000)
+	tx2 := txtest.NewTx([]*wire.MsgTx{missingParent2, missingParent1}, 1000)
+
+	provider := make(AncestorMap)
+	provider.Add(parent)
+
+	_, err := ExpandTxs(ctx, provider, []*wire.MsgTx{tx1, tx2})
+	t.Logf("Expand error : %v", err)
+
+	if !errors.Is(err, ErrMissingAncestors) {
+		t.Fatalf("Wrong error : got %v, want %s", err, ErrMissingAncestors)
+	}
+
+	var missingErr MissingAncestorsError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("Error should be a missing ancestors error : %s", err)
+	}
+
+	wantTxIDs := []bitcoin.Hash32{*missingParent1.TxHash(), *missingParent2.TxHash()}
+	if len(missingErr.TxIDs) != len(wantTxIDs) {
+		t.Fatalf("Wrong missing txid count : got %d, want %d", len(missingErr.TxIDs),
+			len(wantTxIDs))
+	}
+
+	for i, wantTxID := range wantTxIDs {
+		if !missingErr.TxIDs[i].Equal(&wantTxID) {
+			t.Fatalf("Wrong missing txid %d : got %s, want %s", i, missingErr.TxIDs[i],
+				wantTxID)
+		}
+	}
+
+	wantInputs := []struct {
+		txIndex    int
+		inputIndex int
+	}{
+		{0, 1},
+		{1, 0},
+		{1, 1},
+	}
+
+	if len(missingErr.Inputs) != len(wantInputs) {
+		t.Fatalf("Wrong missing input count : got %d, want %d", len(missingErr.Inputs),
+			len(wantInputs))
+	}
+
+	for i, want := range wantInputs {
+		got := missingErr.Inputs[i]
+		if got.TxIndex != want.txIndex || got.Index != want.inputIndex {
+			t.Fatalf("Wrong missing input %d : got tx %d input %d, want tx %d input %d", i,
+				got.TxIndex, got.Index, want.txIndex, want.inputIndex)
+		}
+	}
+
+	// A provider returning the wrong tx is an error.
+	wrongProvider := AncestorMap{*missingParent1.TxHash(): missingParent2}
+	wrongTx := txtest.NewTx([]*wire.MsgTx{missingParent1}, 1000)
+	if _, err := ExpandTx(ctx, wrongProvider, wrongTx); !errors.Is(err, ErrWrongAncestor) {
+		t.Fatalf("Wrong error : got %v, want %s", err, ErrWrongAncestor)
+	}
+}
@@ -2,8 +2,12 @@ package arc
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
+	"github.com/tokenized/arc/pkg/beef"
+	"github.com/tokenized/arc/pkg/bump"
+	"github.com/tokenized/arc/pkg/tef"
 	"github.com/tokenized/pkg/bitcoin"
 	"github.com/tokenized/pkg/expanded_tx"
 
@@ -60,11 +64,36 @@ const (
 
 	// TxStatusRejected - The transaction has been rejected by the Bitcoin network.
 	TxStatusRejected = TxStatus(109)
+
+	// The statuses below are only decoded from their names because ARC's integer values for them
+	// aren't compatible with the values above. Their integer values are only used within this
+	// package.
+
+	// TxStatusDoubleSpendAttempted - A competing transaction that spends the same inputs has been
+	// seen. The competing transactions are listed in competingTxs. Either transaction could still
+	// be mined.
+	TxStatusDoubleSpendAttempted = TxStatus(0xffffff01)
+
+	// TxStatusSeenMultipleNodes - The transaction has been seen on the network by multiple nodes.
+	TxStatusSeenMultipleNodes = TxStatus(0xffffff02)
+
+	// TxStatusMinedInStaleBlock - The transaction was mined into a block that is no longer in the
+	// longest chain. It is expected to be mined again.
+	TxStatusMinedInStaleBlock = TxStatus(0xffffff03)
+
+	// TxStatusUnrecognized - The status received from ARC isn't known to this package. The raw
+	// status text is kept in the RawTxStatus field of the response or callback.
+	TxStatusUnrecognized = TxStatus(0xffffffff)
 )
 
 var (
 	ErrTimeout         = errors.New("Timeout")
+	ErrCanceled        = errors.New("Canceled")
 	ErrInvalidTxStatus = errors.New("Invalid Tx Status")
+
+	// ErrOptionsNotSupported is returned when submit options are used with a client that doesn't
+	// implement OptionsClient.
+	ErrOptionsNotSupported = errors.New("Options Not Supported")
 )
 
 type TxStatus uint32
@@ -79,6 +108,65 @@ type Client interface {
 	SubmitTxsBytes(context.Context, []byte) ([]*TxSubmitResponse, error)
 }
 
+// OptionsClient is a Client that accepts settings for each submission.
+type OptionsClient interface {
+	Client
+
+	SubmitTxWithOptions(context.Context, expanded_tx.TransactionWithOutputs,
+		SubmitOptions) (*TxSubmitResponse, error)
+	SubmitTxBytesWithOptions(context.Context, []byte, SubmitOptions) (*TxSubmitResponse, error)
+	SubmitTxsWithOptions(context.Context, []expanded_tx.TransactionWithOutputs,
+		SubmitOptions) ([]*TxSubmitResponse, error)
+	SubmitTxsBytesWithOptions(context.Context, []byte,
+		SubmitOptions) ([]*TxSubmitResponse, error)
+}
+
+// SubmitOptions are the settings for a single submission that are sent to ARC as headers.
+type SubmitOptions struct {
+	// CallbackURL is where ARC sends status updates for the submitted txs. When empty the callback
+	// url of the client is used. For batch submissions it applies to all of the txs in the batch.
+	// If it is a peer channel url containing a token then the token is sent separately.
+	CallbackURL string
+
+	// CallbackToken is sent to ARC to be included in callbacks. It is sent with CallbackURL, or the
+	// client's callback url when CallbackURL is empty, and overrides a token in that url. When empty
+	// the token in the url is used.
+	CallbackToken string
+
+	// NoCallback stops the client's callback url from being sent so ARC doesn't send callbacks for
+	// the submission. CallbackURL and CallbackToken are ignored when it is set.
+	NoCallback bool
+
+	// WaitForStatus is the status ARC waits for before responding. TxStatusUnknown leaves it to the
+	// ARC default.
+	WaitForStatus TxStatus
+
+	// MaxTimeout is the longest ARC will wait for WaitForStatus. It is reduced to the context's
+	// deadline when that is sooner. Zero leaves it to the ARC default.
+	MaxTimeout time.Duration
+
+	SkipFeeValidation       bool
+	SkipScriptValidation    bool
+	SkipTxValidation        bool
+	CumulativeFeeValidation bool
+
+	// CallbackBatch requests that callbacks are batched together.
+	CallbackBatch bool
+
+	// FullStatusUpdates requests callbacks for all status updates instead of only the final
+	// statuses.
+	FullStatusUpdates bool
+
+	// TxFormat and BodyEncoding override the client config for txs that aren't already serialized.
+	// BodyEncoding also applies to tx bytes.
+	TxFormat     TxFormat
+	BodyEncoding BodyEncoding
+
+	// BlockHeights are used to convert merkle proofs when txs are submitted as BEEF. When nil the
+	// block heights of the client are used.
+	BlockHeights beef.BlockHeights
+}
+
 type MiningFee struct {
 	Satoshis uint64 `json:"satoshis"`
 	Bytes    uint64 `json:"bytes"`
@@ -95,6 +183,18 @@ type PolicyData struct {
 	MiningFee        MiningFee `json:"miningFee"`
 }
 
+// TxLimits returns limits for deserializing txs that are based on the max tx size of the policy.
+// Scripts are only limited by the tx size since the max script size policy doesn't apply to data
+// outputs.
+func (p PolicyData) TxLimits() tef.Limits {
+	limits := tef.DefaultLimits()
+	if p.MaxTxSize > 0 {
+		limits.MaxTxSize = uint64(p.MaxTxSize)
+	}
+
+	return limits
+}
+
 type Policy struct {
 	Timestamp time.Time  `json:"timestamp"`
 	Policy    PolicyData `json:"policy"`
@@ -108,6 +208,14 @@ type TxStatusResponse struct {
 	MerklePath  *string        `json:"merklePath,omitempty"` // https://bsv.brc.dev/transactions/0074
 	TxStatus    TxStatus       `json:"txStatus"`
 	ExtraInfo   *string        `json:"extraInfo,omitempty"`
+
+	CompetingTxs []bitcoin.Hash32 `json:"competingTxs,omitempty"`
+
+	// RawTxStatus is the txStatus text as received. It is needed when the status is unrecognized.
+	RawTxStatus string `json:"-"`
+
+	// Extra contains fields that aren't recognized or couldn't be decoded.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type TxSubmitResponse struct {
@@ -120,6 +228,14 @@ type TxSubmitResponse struct {
 	MerklePath  *string        `json:"merklePath,omitempty"` // https://bsv.brc.dev/transactions/0074
 	TxStatus    TxStatus       `json:"txStatus"`
 	ExtraInfo   *string        `json:"extraInfo,omitempty"`
+
+	CompetingTxs []bitcoin.Hash32 `json:"competingTxs,omitempty"`
+
+	// RawTxStatus is the txStatus text as received. It is needed when the status is unrecognized.
+	RawTxStatus string `json:"-"`
+
+	// Extra contains fields that aren't recognized or couldn't be decoded.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type ErrorData struct {
@@ -146,6 +262,14 @@ type Callback struct {
 	BlockHeight int             `json:"blockHeight,omitempty"`
 	MerklePath  *string         `json:"merklePath,omitempty"` // https://bsv.brc.dev/transactions/0074
 	TxStatus    *TxStatus       `json:"txStatus,omitempty"`
+
+	CompetingTxs []bitcoin.Hash32 `json:"competingTxs,omitempty"`
+
+	// RawTxStatus is the txStatus text as received. It is needed when the status is unrecognized.
+	RawTxStatus string `json:"-"`
+
+	// Extra contains fields that aren't recognized or couldn't be decoded.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 func (r TxStatusResponse) Description() string {
@@ -168,6 +292,22 @@ func (r TxSubmitResponse) Description() string {
 	return ""
 }
 
+func (d ErrorData) Description() string {
+	if len(d.Detail) > 0 {
+		return d.Detail
+	}
+
+	if len(d.Title) > 0 {
+		return d.Title
+	}
+
+	if d.ExtraInfo != nil {
+		return *d.ExtraInfo
+	}
+
+	return ""
+}
+
 func (c Callback) Description() string {
 	if len(c.Title) > 0 {
 		return c.Title
@@ -184,6 +324,65 @@ func (c Callback) Description() string {
 	return ""
 }
 
+// CompetingTxIDs returns the txids of the txs that spend the same inputs as this tx.
+func (r TxStatusResponse) CompetingTxIDs() []bitcoin.Hash32 {
+	return r.CompetingTxs
+}
+
+// IsDoubleSpend returns true if a tx that spends the same inputs has been seen.
+func (r TxStatusResponse) IsDoubleSpend() bool {
+	return r.TxStatus == TxStatusDoubleSpendAttempted || len(r.CompetingTxs) > 0
+}
+
+// CompetingTxIDs returns the txids of the txs that spend the same inputs as this tx.
+func (r TxSubmitResponse) CompetingTxIDs() []bitcoin.Hash32 {
+	return r.CompetingTxs
+}
+
+// IsDoubleSpend returns true if a tx that spends the same inputs has been seen.
+func (r TxSubmitResponse) IsDoubleSpend() bool {
+	return r.TxStatus == TxStatusDoubleSpendAttempted || len(r.CompetingTxs) > 0
+}
+
+// CompetingTxIDs returns the txids of the txs that spend the same inputs as this tx.
+func (c Callback) CompetingTxIDs() []bitcoin.Hash32 {
+	return c.CompetingTxs
+}
+
+// IsDoubleSpend returns true if a tx that spends the same inputs has been seen.
+func (c Callback) IsDoubleSpend() bool {
+	return (c.TxStatus != nil && *c.TxStatus == TxStatusDoubleSpendAttempted) ||
+		len(c.CompetingTxs) > 0
+}
+
+// ParseMerklePath returns the BRC-74 merkle path of the tx. It returns nil when there isn't one.
+func (r TxStatusResponse) ParseMerklePath() (*bump.MerklePath, error) {
+	return parseMerklePath(r.MerklePath)
+}
+
+// ParseMerklePath returns the BRC-74 merkle path of the tx. It returns nil when there isn't one.
+func (r TxSubmitResponse) ParseMerklePath() (*bump.MerklePath, error) {
+	return parseMerklePath(r.MerklePath)
+}
+
+// ParseMerklePath returns the BRC-74 merkle path of the tx. It returns nil when there isn't one.
+func (c Callback) ParseMerklePath() (*bump.MerklePath, error) {
+	return parseMerklePath(c.MerklePath)
+}
+
+func parseMerklePath(s *string) (*bump.MerklePath, error) {
+	if s == nil || len(*s) == 0 {
+		return nil, nil
+	}
+
+	path, err := bump.ParseHex(*s)
+	if err != nil {
+		return nil, errors.Wrap(err, "merkle path")
+	}
+
+	return path, nil
+}
+
 func (s TxStatus) String() string {
 	switch s {
 	case TxStatusUnknown:
@@ -212,6 +411,14 @@ func (s TxStatus) String() string {
 		return "REJECTED"
 	case TxStatusOrphaned:
 		return "SEEN_IN_ORPHAN_MEMPOOL"
+	case TxStatusDoubleSpendAttempted:
+		return "DOUBLE_SPEND_ATTEMPTED"
+	case TxStatusSeenMultipleNodes:
+		return "SEEN_MULTIPLE_NODES"
+	case TxStatusMinedInStaleBlock:
+		return "MINED_IN_STALE_BLOCK"
+	case TxStatusUnrecognized:
+		return "UNRECOGNIZED"
 	default:
 		return ""
 	}
@@ -245,6 +452,14 @@ func (s *TxStatus) SetString(v string) error {
 		*s = TxStatusRejected
 	case "SEEN_IN_ORPHAN_MEMPOOL":
 		*s = TxStatusOrphaned
+	case "DOUBLE_SPEND_ATTEMPTED":
+		*s = TxStatusDoubleSpendAttempted
+	case "SEEN_MULTIPLE_NODES":
+		*s = TxStatusSeenMultipleNodes
+	case "MINED_IN_STALE_BLOCK":
+		*s = TxStatusMinedInStaleBlock
+	case "UNRECOGNIZED":
+		*s = TxStatusUnrecognized
 	default:
 		*s = TxStatusUnknown
 		return errors.Wrap(ErrInvalidTxStatus, v)
@@ -0,0 +1,497 @@
+package arctest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tokenized/arc"
+	"github.com/tokenized/arc/pkg/tef"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	MethodGetPolicy                 = "GetPolicy"
+	MethodGetTxStatus               = "GetTxStatus"
+	MethodSubmitTx                  = "SubmitTx"
+	MethodSubmitTxBytes             = "SubmitTxBytes"
+	MethodSubmitTxs                 = "SubmitTxs"
+	MethodSubmitTxsBytes            = "SubmitTxsBytes"
+	MethodSubmitTxWithOptions       = "SubmitTxWithOptions"
+	MethodSubmitTxBytesWithOptions  = "SubmitTxBytesWithOptions"
+	MethodSubmitTxsWithOptions      = "SubmitTxsWithOptions"
+	MethodSubmitTxsBytesWithOptions = "SubmitTxsBytesWithOptions"
+)
+
+// MockClient is an in-memory arc.OptionsClient for unit tests. It is safe for concurrent use.
+// Responses and errors can be programmed per txid, calls are recorded, and submitted txs can be
+// moved through their status progression.
+type MockClient struct {
+	url    string
+	policy arc.Policy
+
+	policyError error
+	submitError map[bitcoin.Hash32]error
+	statusError map[bitcoin.Hash32]error
+	responses   map[bitcoin.Hash32]*arc.TxSubmitResponse
+
+	defaultProgression []arc.TxStatus
+	progressions       map[bitcoin.Hash32][]arc.TxStatus
+	txs                map[bitcoin.Hash32]*mockTx
+
+	calls []*Call
+
+	lock sync.Mutex
+}
+
+// Call is a call made to a MockClient.
+type Call struct {
+	Method  string
+	TxID    bitcoin.Hash32   // txid for GetTxStatus
+	TxIDs   []bitcoin.Hash32 // txids of submitted txs
+	Bytes   []byte           // TEF bytes of submitted txs
+	Options *arc.SubmitOptions
+}
+
+type mockTx struct {
+	status      arc.TxStatus
+	position    int
+	progression []arc.TxStatus
+}
+
+func NewMockClient() *MockClient {
+	progression := make([]arc.TxStatus, len(DefaultProgression), len(DefaultProgression)+1)
+	copy(progression, DefaultProgression)
+	progression = append(progression, arc.TxStatusMined)
+
+	return &MockClient{
+		url: "mock://arc",
+		policy: arc.Policy{
+			Timestamp: time.Now(),
+			Policy: arc.PolicyData{
+				MaxScriptSize:    100000000,
+				MaxTxSigOpsCount: 4294967295,
+				MaxTxSize:        100000000,
+				MiningFee: arc.MiningFee{
+					Satoshis: 1,
+					Bytes:    1000,
+				},
+			},
+		},
+		submitError:        make(map[bitcoin.Hash32]error),
+		statusError:        make(map[bitcoin.Hash32]error),
+		responses:          make(map[bitcoin.Hash32]*arc.TxSubmitResponse),
+		defaultProgression: progression,
+		progressions:       make(map[bitcoin.Hash32][]arc.TxStatus),
+		txs:                make(map[bitcoin.Hash32]*mockTx),
+	}
+}
+
+func (c *MockClient) SetURL(url string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.url = url
+}
+
+func (c *MockClient) SetPolicy(policy arc.Policy) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.policy = policy
+}
+
+// SetPolicyError makes GetPolicy return the error. A nil error clears it.
+func (c *MockClient) SetPolicyError(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.policyError = err
+}
+
+// SetSubmitError makes submissions containing the tx return the error. A nil error clears it.
+func (c *MockClient) SetSubmitError(txid bitcoin.Hash32, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err == nil {
+		delete(c.submitError, txid)
+	} else {
+		c.submitError[txid] = err
+	}
+}
+
+// SetStatusError makes GetTxStatus return the error for the tx. A nil error clears it.
+func (c *MockClient) SetStatusError(txid bitcoin.Hash32, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err == nil {
+		delete(c.statusError, txid)
+	} else {
+		c.statusError[txid] = err
+	}
+}
+
+// SetSubmitResponse sets the response returned for submissions of the tx. A nil response clears
+// it.
+func (c *MockClient) SetSubmitResponse(txid bitcoin.Hash32, response *arc.TxSubmitResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if response == nil {
+		delete(c.responses, txid)
+	} else {
+		c.responses[txid] = response
+	}
+}
+
+// SetProgression sets the statuses that the tx will move through. The first status is set when the
+// tx is submitted and Advance moves it to the next status.
+func (c *MockClient) SetProgression(txid bitcoin.Hash32, statuses ...arc.TxStatus) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.progressions[txid] = statuses
+	if tx, exists := c.txs[txid]; exists {
+		tx.progression = statuses
+		tx.position = 0
+		if len(statuses) > 0 {
+			tx.status = statuses[0]
+		}
+	}
+}
+
+// Advance moves the tx to the next status in its progression and returns the new status.
+func (c *MockClient) Advance(txid bitcoin.Hash32) (arc.TxStatus, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	tx, exists := c.txs[txid]
+	if !exists {
+		return arc.TxStatusUnknown, errors.Wrap(ErrTxNotFound, txid.String())
+	}
+
+	if tx.position+1 >= len(tx.progression) {
+		return tx.status, errors.Wrap(ErrProgressionComplete, txid.String())
+	}
+
+	tx.position++
+	tx.status = tx.progression[tx.position]
+	return tx.status, nil
+}
+
+// AdvanceTo moves the tx through its progression until it reaches the status.
+func (c *MockClient) AdvanceTo(txid bitcoin.Hash32, status arc.TxStatus) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	tx, exists := c.txs[txid]
+	if !exists {
+		return errors.Wrap(ErrTxNotFound, txid.String())
+	}
+
+	for tx.status != status {
+		if tx.position+1 >= len(tx.progression) {
+			return errors.Wrapf(ErrProgressionComplete, "%s: %s not reached", txid, status)
+		}
+
+		tx.position++
+		tx.status = tx.progression[tx.position]
+	}
+
+	return nil
+}
+
+// SetStatus sets the status of the tx, adding the tx if it hasn't been submitted.
+func (c *MockClient) SetStatus(txid bitcoin.Hash32, status arc.TxStatus) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	tx := c.addTx(txid)
+	tx.status = status
+}
+
+// Status returns the current status of the tx.
+func (c *MockClient) Status(txid bitcoin.Hash32) arc.TxStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	tx, exists := c.txs[txid]
+	if !exists {
+		return arc.TxStatusUnknown
+	}
+
+	return tx.status
+}
+
+// Calls returns the calls that have been made to the client.
+func (c *MockClient) Calls() []*Call {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	result := make([]*Call, len(c.calls))
+	copy(result, c.calls)
+	return result
+}
+
+// CallsTo returns the calls that have been made to the method.
+func (c *MockClient) CallsTo(method string) []*Call {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var result []*Call
+	for _, call := range c.calls {
+		if call.Method == method {
+			result = append(result, call)
+		}
+	}
+
+	return result
+}
+
+// ClearCalls removes the recorded calls.
+func (c *MockClient) ClearCalls() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.calls = nil
+}
+
+func (c *MockClient) URL() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.url
+}
+
+func (c *MockClient) GetPolicy(ctx context.Context) (*arc.Policy, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.calls = append(c.calls, &Call{
+		Method: MethodGetPolicy,
+	})
+
+	if c.policyError != nil {
+		return nil, c.policyError
+	}
+
+	policy := c.policy
+	return &policy, nil
+}
+
+func (c *MockClient) GetTxStatus(ctx context.Context,
+	txid bitcoin.Hash32) (*arc.TxStatusResponse, error) {
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.calls = append(c.calls, &Call{
+		Method: MethodGetTxStatus,
+		TxID:   txid,
+	})
+
+	if err, exists := c.statusError[txid]; exists {
+		return nil, err
+	}
+
+	tx, exists := c.txs[txid]
+	if !exists {
+		return nil, arc.HTTPError{
+			Status:  http.StatusNotFound,
+			Message: "transaction not found",
+		}
+	}
+
+	return &arc.TxStatusResponse{
+		Timestamp: time.Now(),
+		TxID:      txid,
+		TxStatus:  tx.status,
+	}, nil
+}
+
+func (c *MockClient) SubmitTx(ctx context.Context,
+	tx expanded_tx.TransactionWithOutputs) (*arc.TxSubmitResponse, error) {
+
+	b, err := serializeTxs([]expanded_tx.TransactionWithOutputs{tx})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.submit(MethodSubmitTx, b, nil)
+}
+
+func (c *MockClient) SubmitTxBytes(ctx context.Context,
+	txBytes []byte) (*arc.TxSubmitResponse, error) {
+
+	return c.submit(MethodSubmitTxBytes, txBytes, nil)
+}
+
+func (c *MockClient) SubmitTxs(ctx context.Context,
+	txs []expanded_tx.TransactionWithOutputs) ([]*arc.TxSubmitResponse, error) {
+
+	b, err := serializeTxs(txs)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.submitBatch(MethodSubmitTxs, b, nil)
+}
+
+func (c *MockClient) SubmitTxsBytes(ctx context.Context,
+	txsBytes []byte) ([]*arc.TxSubmitResponse, error) {
+
+	return c.submitBatch(MethodSubmitTxsBytes, txsBytes, nil)
+}
+
+func (c *MockClient) SubmitTxWithOptions(ctx context.Context,
+	tx expanded_tx.TransactionWithOutputs,
+	options arc.SubmitOptions) (*arc.TxSubmitResponse, error) {
+
+	b, err := serializeTxs([]expanded_tx.TransactionWithOutputs{tx})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.submit(MethodSubmitTxWithOptions, b, &options)
+}
+
+func (c *MockClient) SubmitTxBytesWithOptions(ctx context.Context, txBytes []byte,
+	options arc.SubmitOptions) (*arc.TxSubmitResponse, error) {
+
+	return c.submit(MethodSubmitTxBytesWithOptions, txBytes, &options)
+}
+
+func (c *MockClient) SubmitTxsWithOptions(ctx context.Context,
+	txs []expanded_tx.TransactionWithOutputs,
+	options arc.SubmitOptions) ([]*arc.TxSubmitResponse, error) {
+
+	b, err := serializeTxs(txs)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.submitBatch(MethodSubmitTxsWithOptions, b, &options)
+}
+
+func (c *MockClient) SubmitTxsBytesWithOptions(ctx context.Context, txsBytes []byte,
+	options arc.SubmitOptions) ([]*arc.TxSubmitResponse, error) {
+
+	return c.submitBatch(MethodSubmitTxsBytesWithOptions, txsBytes, &options)
+}
+
+func (c *MockClient) submit(method string, txBytes []byte,
+	options *arc.SubmitOptions) (*arc.TxSubmitResponse, error) {
+
+	responses, err := c.submitBatch(method, txBytes, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(responses) != 1 {
+		return nil, arc.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "request must contain one tx",
+		}
+	}
+
+	return responses[0], nil
+}
+
+// submitBatch records the call and returns a response for each tx. If an error is set for any of
+// the txs then that error is returned for the whole call.
+func (c *MockClient) submitBatch(method string, txsBytes []byte,
+	options *arc.SubmitOptions) ([]*arc.TxSubmitResponse, error) {
+
+	b := make([]byte, len(txsBytes))
+	copy(b, txsBytes)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	call := &Call{
+		Method:  method,
+		Bytes:   b,
+		Options: options,
+	}
+	c.calls = append(c.calls, call)
+
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		txid, err := tef.DeserializeTxID(r)
+		if err != nil {
+			return nil, arc.HTTPError{
+				Status:  461,
+				Message: err.Error(),
+			}
+		}
+
+		call.TxIDs = append(call.TxIDs, txid)
+	}
+
+	for _, txid := range call.TxIDs {
+		if err, exists := c.submitError[txid]; exists {
+			return nil, err
+		}
+	}
+
+	var result []*arc.TxSubmitResponse
+	for _, txid := range call.TxIDs {
+		if response, exists := c.responses[txid]; exists {
+			r := *response
+			result = append(result, &r)
+			continue
+		}
+
+		tx := c.addTx(txid)
+		result = append(result, &arc.TxSubmitResponse{
+			Timestamp: time.Now(),
+			Status:    http.StatusOK,
+			Title:     "OK",
+			TxID:      txid,
+			TxStatus:  tx.status,
+		})
+	}
+
+	return result, nil
+}
+
+// addTx returns the tx, adding it at the start of its progression if it doesn't exist. The lock
+// must be held by the caller.
+func (c *MockClient) addTx(txid bitcoin.Hash32) *mockTx {
+	if tx, exists := c.txs[txid]; exists {
+		return tx
+	}
+
+	progression, exists := c.progressions[txid]
+	if !exists {
+		progression = c.defaultProgression
+	}
+
+	tx := &mockTx{
+		progression: progression,
+	}
+	if len(progression) > 0 {
+		tx.status = progression[0]
+	}
+
+	c.txs[txid] = tx
+	return tx
+}
+
+func serializeTxs(txs []expanded_tx.TransactionWithOutputs) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for i, tx := range txs {
+		if err := tef.Serialize(buf, tx); err != nil {
+			return nil, errors.Wrapf(err, "serialize tx %d", i)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,113 @@
+package arctest
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/tokenized/arc"
+	"github.com/tokenized/arc/internal/txtest"
+	"github.com/tokenized/arc/pkg/tef"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+
+	"github.com/pkg/errors"
+)
+
+func Test_MockClient(t *testing.T) {
+	client := NewMockClient()
+	ctx := context.Background()
+
+	etx1 := txtest.NewExpandedTx(1, 9990)
+	txid1 := etx1.TxID()
+	etx2 := txtest.NewExpandedTx(1, 9990)
+	txid2 := etx2.TxID()
+
+	buf := &bytes.Buffer{}
+	tef.Serialize(buf, etx1)
+	tef.Serialize(buf, etx2)
+	txsBytes := buf.Bytes()
+
+	client.SetSubmitError(txid2, arc.HTTPError{Status: 465})
+	if _, err := client.SubmitTxsBytes(ctx, txsBytes); !errors.Is(err, arc.ErrFeeTooLow) {
+		t.Fatalf("Wrong submit error : got %v, want %s", err, arc.ErrFeeTooLow)
+	}
+
+	client.SetSubmitError(txid2, nil)
+	responses, err := client.SubmitTxsBytes(ctx, txsBytes)
+	if err != nil {
+		t.Fatalf("Failed to submit txs : %s", err)
+	}
+
+	if len(responses) != 2 {
+		t.Fatalf("Wrong response count : got %d, want %d", len(responses), 2)
+	}
+
+	calls := client.CallsTo(MethodSubmitTxsBytes)
+	if len(calls) != 2 {
+		t.Fatalf("Wrong call count : got %d, want %d", len(calls), 2)
+	}
+
+	if !bytes.Equal(calls[1].Bytes, txsBytes) {
+		t.Fatalf("Wrong recorded bytes : \n  got %x\n want %x", calls[1].Bytes, txsBytes)
+	}
+
+	if len(calls[1].TxIDs) != 2 || !calls[1].TxIDs[0].Equal(&txid1) ||
+		!calls[1].TxIDs[1].Equal(&txid2) {
+		t.Fatalf("Wrong recorded txids : %v", calls[1].TxIDs)
+	}
+
+	if err := client.AdvanceTo(txid1, arc.TxStatusSeen); err != nil {
+		t.Fatalf("Failed to advance : %s", err)
+	}
+
+	status, err := client.Advance(txid1)
+	if err != nil {
+		t.Fatalf("Failed to advance : %s", err)
+	}
+
+	if status != arc.TxStatusMined {
+		t.Fatalf("Wrong status : got %s, want %s", status, arc.TxStatusMined)
+	}
+
+	statusResponse, err := client.GetTxStatus(ctx, txid1)
+	if err != nil {
+		t.Fatalf("Failed to get status : %s", err)
+	}
+
+	if statusResponse.TxStatus != arc.TxStatusMined {
+		t.Fatalf("Wrong status : got %s, want %s", statusResponse.TxStatus, arc.TxStatusMined)
+	}
+
+	if _, err := client.GetTxStatus(ctx, bitcoin.Hash32{}); err == nil {
+		t.Fatalf("Status of unknown tx should fail")
+	}
+}
+
+func Test_MockClient_Concurrent(t *testing.T) {
+	client := NewMockClient()
+	ctx := context.Background()
+
+	var wait sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+
+			etx := txtest.NewExpandedTx(1, 9990)
+			if _, err := client.SubmitTxs(ctx,
+				[]expanded_tx.TransactionWithOutputs{etx}); err != nil {
+				t.Errorf("Failed to submit tx : %s", err)
+			}
+			client.GetTxStatus(ctx, etx.TxID())
+		}()
+	}
+	wait.Wait()
+
+	if count := len(client.Calls()); count != 20 {
+		t.Fatalf("Wrong call count : got %d, want %d", count, 20)
+	}
+}
+
+var _ arc.OptionsClient = (*MockClient)(nil)
@@ -0,0 +1,265 @@
+package arctest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/tokenized/arc"
+)
+
+const (
+	// FaultLatency delays the response by the fault's Latency. It can be combined with the other
+	// faults.
+	FaultLatency = FaultType(1)
+
+	// FaultServerError responds with the fault's Status, or 500 when it isn't set, instead of
+	// processing the request.
+	FaultServerError = FaultType(2)
+
+	// FaultGatewayTimeout responds with 504 instead of processing the request.
+	FaultGatewayTimeout = FaultType(3)
+
+	// FaultTruncatedJSON processes the request, but only writes the first half of the response
+	// body.
+	FaultTruncatedJSON = FaultType(4)
+
+	// FaultInvalidJSON processes the request, but responds with a body that isn't valid JSON.
+	FaultInvalidJSON = FaultType(5)
+
+	// FaultDropConnection closes the connection without responding or processing the request.
+	FaultDropConnection = FaultType(6)
+
+	// FaultDuplicateCallback delivers a callback twice.
+	FaultDuplicateCallback = FaultType(7)
+
+	// FaultReorderCallback holds a callback and delivers it after the next callback, or when
+	// WaitForCallbacks or Close is called.
+	FaultReorderCallback = FaultType(8)
+
+	// Routes used to limit faults to specific endpoints.
+	RoutePolicy    = arc.PathPolicy
+	RouteTxStatus  = "v1/tx/{txid}"
+	RouteSubmitTx  = arc.PathSubmitTx
+	RouteSubmitTxs = arc.PathSubmitTxs
+)
+
+type FaultType uint8
+
+// Fault is a failure that the server injects into requests or callbacks.
+type Fault struct {
+	Type FaultType
+
+	// Route limits the fault to one endpoint. Empty applies the fault to all endpoints. Callback
+	// faults ignore the route.
+	Route string
+
+	// Probability is the chance, from 0 to 1, that the fault is injected into each request. Nil is
+	// always. Use FaultProbability to set it.
+	Probability *float64
+
+	// Count is the maximum number of times the fault is injected. Zero is unlimited.
+	Count int
+
+	Latency time.Duration // used by FaultLatency
+	Status  int           // used by FaultServerError
+
+	injected int
+}
+
+// FaultProbability returns a fault probability so that it can be set inline.
+func FaultProbability(probability float64) *float64 {
+	return &probability
+}
+
+// AddFault adds a fault to be injected into matching requests or callbacks.
+func (s *Server) AddFault(fault Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes all faults.
+func (s *Server) ClearFaults() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.faults = nil
+}
+
+// SetFaultSeed seeds the random number generator used for fault probabilities so that fault
+// injection is repeatable.
+func (s *Server) SetFaultSeed(seed int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.random.Seed(seed)
+}
+
+// InjectedFaults returns the number of times faults of the type have been injected.
+func (s *Server) InjectedFaults(faultType FaultType) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := 0
+	for _, fault := range s.faults {
+		if fault.Type == faultType {
+			result += fault.injected
+		}
+	}
+
+	return result
+}
+
+func (t FaultType) String() string {
+	switch t {
+	case FaultLatency:
+		return "latency"
+	case FaultServerError:
+		return "server_error"
+	case FaultGatewayTimeout:
+		return "gateway_timeout"
+	case FaultTruncatedJSON:
+		return "truncated_json"
+	case FaultInvalidJSON:
+		return "invalid_json"
+	case FaultDropConnection:
+		return "drop_connection"
+	case FaultDuplicateCallback:
+		return "duplicate_callback"
+	case FaultReorderCallback:
+		return "reorder_callback"
+	default:
+		return ""
+	}
+}
+
+func (t FaultType) isCallback() bool {
+	return t == FaultDuplicateCallback || t == FaultReorderCallback
+}
+
+// selectFaults returns the request faults to inject for the route.
+func (s *Server) selectFaults(route string) []*Fault {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var result []*Fault
+	for _, fault := range s.faults {
+		if fault.Type.isCallback() {
+			continue
+		}
+
+		if len(fault.Route) > 0 && fault.Route != route {
+			continue
+		}
+
+		if s.inject(fault) {
+			result = append(result, fault)
+		}
+	}
+
+	return result
+}
+
+// injectCallbackFault returns true if a callback fault of the type should be injected.
+func (s *Server) injectCallbackFault(faultType FaultType) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, fault := range s.faults {
+		if fault.Type == faultType && s.inject(fault) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inject returns true if the fault should be injected and counts it. The lock must be held by the
+// caller.
+func (s *Server) inject(fault *Fault) bool {
+	if fault.Count > 0 && fault.injected >= fault.Count {
+		return false
+	}
+
+	if fault.Probability != nil && s.random.Float64() >= *fault.Probability {
+		return false
+	}
+
+	fault.injected++
+	return true
+}
+
+// handleWithFaults wraps the handler so that faults for the route are injected.
+func (s *Server) handleWithFaults(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var responseFault *Fault
+		for _, fault := range s.selectFaults(route) {
+			if fault.Type != FaultLatency {
+				if responseFault == nil {
+					responseFault = fault
+				}
+				continue
+			}
+
+			select {
+			case <-time.After(fault.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if responseFault == nil {
+			handler(w, r)
+			return
+		}
+
+		switch responseFault.Type {
+		case FaultServerError:
+			status := responseFault.Status
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			writeError(w, status, "injected fault", nil)
+
+		case FaultGatewayTimeout:
+			writeError(w, http.StatusGatewayTimeout, "injected fault", nil)
+
+		case FaultDropConnection:
+			ioutil.ReadAll(r.Body)
+
+			hijacker, ok := w.(http.Hijacker)
+			if !ok {
+				writeError(w, http.StatusInternalServerError, "connection can't be dropped", nil)
+				return
+			}
+
+			conn, _, err := hijacker.Hijack()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError,
+					fmt.Sprintf("connection can't be dropped : %s", err), nil)
+				return
+			}
+			conn.Close()
+
+		case FaultTruncatedJSON, FaultInvalidJSON:
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+
+			for key, values := range recorder.Header() {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(recorder.Code)
+
+			body := recorder.Body.Bytes()
+			if responseFault.Type == FaultTruncatedJSON {
+				w.Write(body[:len(body)/2])
+			} else {
+				w.Write([]byte(`{"txStatus":SEEN_ON_NETWORK,}`))
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package arctest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tokenized/arc"
+	"github.com/tokenized/arc/internal/txtest"
+	"github.com/tokenized/config"
+
+	"github.com/pkg/errors"
+)
+
+func testFaultConfig(maxAttempts int) arc.Config {
+	result := arc.DefaultConfig()
+	result.MaxAttempts = maxAttempts
+	result.BaseBackoff = config.NewDuration(time.Millisecond)
+	result.MaxBackoff = config.NewDuration(10 * time.Millisecond)
+	return result
+}
+
+func Test_Server_Faults(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	ctx := context.Background()
+
+	server.AddFault(Fault{
+		Type:   FaultServerError,
+		Route:  RoutePolicy,
+		Status: http.StatusServiceUnavailable,
+		Count:  2,
+	})
+
+	client := arc.NewHTTPClient(server.URL(), "", "", testFaultConfig(3))
+	if _, err := client.GetPolicy(ctx); err != nil {
+		t.Fatalf("Failed to get policy after retries : %s", err)
+	}
+
+	if count := server.InjectedFaults(FaultServerError); count != 2 {
+		t.Fatalf("Wrong injected fault count : got %d, want %d", count, 2)
+	}
+
+	tests := []struct {
+		name  string
+		fault Fault
+		check func(error) bool
+	}{
+		{
+			name:  "gateway timeout",
+			fault: Fault{Type: FaultGatewayTimeout},
+			check: func(err error) bool { return errors.Is(err, arc.ErrTimeout) },
+		},
+		{
+			name:  "dropped connection",
+			fault: Fault{Type: FaultDropConnection},
+			check: arc.IsRetryableError,
+		},
+		{
+			name:  "invalid json",
+			fault: Fault{Type: FaultInvalidJSON},
+			check: isJSONSyntaxError,
+		},
+		{
+			name:  "truncated json",
+			fault: Fault{Type: FaultTruncatedJSON},
+			check: isJSONSyntaxError,
+		},
+		{
+			name:  "latency",
+			fault: Fault{Type: FaultLatency, Latency: time.Second},
+			check: func(err error) bool { return errors.Is(err, arc.ErrTimeout) },
+		},
+	}
+
+	client = arc.NewHTTPClient(server.URL(), "", "", testFaultConfig(1))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.ClearFaults()
+			server.AddFault(tt.fault)
+
+			ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+
+			_, err := client.GetPolicy(ctx)
+			t.Logf("Error : %v", err)
+			if !tt.check(err) {
+				t.Fatalf("Wrong error : %v", err)
+			}
+		})
+	}
+}
+
+// isJSONSyntaxError returns true if the response body couldn't be parsed. It isn't retryable
+// because the endpoint responded successfully.
+func isJSONSyntaxError(err error) bool {
+	var syntaxError *json.SyntaxError
+	return errors.As(err, &syntaxError) && arc.ClassifyError(err) == arc.ErrorClassUnknown
+}
+
+func Test_Server_FaultProbability(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		probability *float64
+		want        int
+	}{
+		{
+			name: "always",
+			want: 10,
+		},
+		{
+			name:        "zero",
+			probability: FaultProbability(0),
+			want:        0,
+		},
+		{
+			name:        "one",
+			probability: FaultProbability(1),
+			want:        10,
+		},
+	}
+
+	client := arc.NewHTTPClient(server.URL(), "", "", testFaultConfig(1))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.ClearFaults()
+			server.AddFault(Fault{
+				Type:        FaultServerError,
+				Route:       RoutePolicy,
+				Probability: tt.probability,
+			})
+
+			for i := 0; i < 10; i++ {
+				client.GetPolicy(context.Background())
+			}
+
+			if count := server.InjectedFaults(FaultServerError); count != tt.want {
+				t.Fatalf("Wrong injected fault count : got %d, want %d", count, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Server_CallbackFaults(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	receiver := newCallbackReceiver()
+	defer receiver.server.Close()
+
+	server.AddFault(Fault{Type: FaultReorderCallback, Count: 1})
+	server.AddFault(Fault{Type: FaultDuplicateCallback, Count: 1})
+
+	client := arc.NewHTTPClient(server.URL(), "", "", testFaultConfig(1))
+
+	etx := txtest.NewExpandedTx(1, 9990)
+	txid := etx.TxID()
+	if _, err := client.SubmitTxWithOptions(context.Background(), etx, arc.SubmitOptions{
+		CallbackURL:       receiver.server.URL,
+		FullStatusUpdates: true,
+	}); err != nil {
+		t.Fatalf("Failed to submit tx : %s", err)
+	}
+
+	server.Advance(txid) // stored, held for reorder
+	server.Advance(txid) // announced, duplicated
+	server.WaitForCallbacks()
+
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+
+	wantStatuses := []arc.TxStatus{arc.TxStatusAnnounced, arc.TxStatusAnnounced,
+		arc.TxStatusStored}
+	if len(receiver.callbacks) != len(wantStatuses) {
+		t.Fatalf("Wrong callback count : got %d, want %d", len(receiver.callbacks),
+			len(wantStatuses))
+	}
+
+	for i, callback := range receiver.callbacks {
+		t.Logf("Callback %d : %s", i, *callback.TxStatus)
+
+		if *callback.TxStatus != wantStatuses[i] {
+			t.Errorf("Wrong callback %d status : got %s, want %s", i, *callback.TxStatus,
+				wantStatuses[i])
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package arctest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tokenized/arc"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+// Headers is an in-memory arc.HeaderProvider.
+type Headers struct {
+	headers map[int]wire.BlockHeader
+
+	lock sync.Mutex
+}
+
+func NewHeaders() *Headers {
+	return &Headers{
+		headers: make(map[int]wire.BlockHeader),
+	}
+}
+
+// SetHeader sets the header of the block at the height, replacing any previous header like a
+// reorg would.
+func (h *Headers) SetHeader(height int, header wire.BlockHeader) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.headers[height] = header
+}
+
+func (h *Headers) GetHeader(ctx context.Context, height int) (*wire.BlockHeader, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	header, exists := h.headers[height]
+	if !exists {
+		return nil, errors.Wrapf(arc.ErrHeaderNotFound, "height %d", height)
+	}
+
+	return &header, nil
+}
+
+// Headers returns a header provider containing the headers of the blocks mined by the server.
+func (s *Server) Headers() *Headers {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := NewHeaders()
+	for _, block := range s.blocks {
+		result.headers[block.Height] = block.Header
+	}
+
+	return result
+}
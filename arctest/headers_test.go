@@ -0,0 +1,101 @@
+package arctest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tokenized/arc"
+	"github.com/tokenized/arc/internal/txtest"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+
+	"github.com/pkg/errors"
+)
+
+func Test_Server_VerifyMerkleProof(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	config := arc.DefaultConfig()
+	client := arc.NewHTTPClient(server.URL(), "", "", config)
+	ctx := context.Background()
+
+	parent := txtest.NewExpandedTx(1, 9990)
+	child := testChildTx(parent.Tx, 0, 9980)
+	if _, err := client.SubmitTx(ctx, parent); err != nil {
+		t.Fatalf("Failed to submit parent : %s", err)
+	}
+	if _, err := client.SubmitTx(ctx, &expanded_tx.ExpandedTx{
+		Tx:        child,
+		Ancestors: expanded_tx.AncestorTxs{{Tx: parent.Tx}},
+	}); err != nil {
+		t.Fatalf("Failed to submit child : %s", err)
+	}
+
+	block, err := server.MineBlock()
+	if err != nil {
+		t.Fatalf("Failed to mine block : %s", err)
+	}
+
+	if _, err := server.MineBlock(); err != nil { // so the provider has more than one header
+		t.Fatalf("Failed to mine block : %s", err)
+	}
+	t.Logf("Mined block %d : %s", block.Height, block.Hash)
+
+	response, err := client.GetTxStatus(ctx, *child.TxHash())
+	if err != nil {
+		t.Fatalf("Failed to get tx status : %s", err)
+	}
+
+	headers := server.Headers()
+	if err := response.VerifyMerkleProof(ctx, headers); err != nil {
+		t.Fatalf("Failed to verify merkle proof : %s", err)
+	}
+
+	wrongHeight := *response
+	wrongHeight.BlockHeight++
+	err = wrongHeight.VerifyMerkleProof(ctx, headers)
+	if !errors.Is(err, arc.ErrWrongBlockHeight) {
+		t.Fatalf("Wrong height error : got %v, want %s", err, arc.ErrWrongBlockHeight)
+	}
+	t.Logf("Wrong height error : %s", err)
+
+	missingTx := *response
+	missingTx.TxID = parent.TxID()
+	err = missingTx.VerifyMerkleProof(ctx, headers)
+	if !errors.Is(err, arc.ErrTxNotInMerklePath) {
+		t.Fatalf("Wrong missing tx error : got %v, want %s", err, arc.ErrTxNotInMerklePath)
+	}
+	t.Logf("Missing tx error : %s", err)
+
+	missingPath := *response
+	missingPath.MerklePath = nil
+	err = missingPath.VerifyMerkleProof(ctx, headers)
+	if !errors.Is(err, arc.ErrMissingMerklePath) {
+		t.Fatalf("Wrong missing path error : got %v, want %s", err, arc.ErrMissingMerklePath)
+	}
+
+	err = response.VerifyMerkleProof(ctx, NewHeaders())
+	if !errors.Is(err, arc.ErrHeaderNotFound) {
+		t.Fatalf("Wrong header error : got %v, want %s", err, arc.ErrHeaderNotFound)
+	}
+
+	// A header with a different merkle root at the same height.
+	badHeaders := NewHeaders()
+	badHeader := block.Header
+	badHeader.MerkleRoot = bitcoin.Hash32{}
+	badHeaders.SetHeader(block.Height, badHeader)
+
+	err = response.VerifyMerkleProof(ctx, badHeaders)
+	if !errors.Is(err, arc.ErrBlockHashMismatch) {
+		t.Fatalf("Wrong block hash error : got %v, want %s", err, arc.ErrBlockHashMismatch)
+	}
+
+	noHash := *response
+	noHash.BlockHash = bitcoin.Hash32{}
+	err = noHash.VerifyMerkleProof(ctx, badHeaders)
+	if !errors.Is(err, arc.ErrMerkleRootMismatch) {
+		t.Fatalf("Wrong root error : got %v, want %s", err, arc.ErrMerkleRootMismatch)
+	}
+	t.Logf("Root mismatch error : %s", err)
+}
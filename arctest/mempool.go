@@ -0,0 +1,392 @@
+package arctest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tokenized/arc"
+	"github.com/tokenized/arc/pkg/bump"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+// Block is a block mined by the fake server.
+type Block struct {
+	Header wire.BlockHeader
+	Hash   bitcoin.Hash32
+	Height int
+	TxIDs  []bitcoin.Hash32 // includes the coinbase tx
+}
+
+// utxo is an output known to the mempool.
+type utxo struct {
+	value   uint64
+	spentBy *bitcoin.Hash32
+}
+
+// MineBlock mines a block containing all of the txs in the mempool, in the order they were
+// accepted, and updates those txs to mined with the block hash, height, and a BRC-74 merkle path.
+func (s *Server) MineBlock() (*Block, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	height := len(s.blocks) + 1
+	var prevBlock bitcoin.Hash32
+	if len(s.blocks) > 0 {
+		prevBlock = s.blocks[len(s.blocks)-1].Hash
+	}
+
+	coinbase := wire.NewMsgTx(1)
+	heightScript := make([]byte, 5)
+	heightScript[0] = 4 // push 4 bytes
+	binary.LittleEndian.PutUint32(heightScript[1:], uint32(height))
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&bitcoin.Hash32{}, 0xffffffff),
+		heightScript))
+	coinbase.AddTxOut(wire.NewTxOut(625000000, bitcoin.Script{0x51})) // OP_TRUE
+
+	txids := []bitcoin.Hash32{*coinbase.TxHash()}
+	txids = append(txids, s.mempool...)
+
+	// Calculate the merkle paths before any state is updated.
+	merklePaths := make([]string, len(s.mempool))
+	for index := range s.mempool {
+		path, err := bump.NewMerklePath(uint64(height), txids, index+1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "merkle path %d", index)
+		}
+
+		merklePaths[index] = path.String()
+	}
+
+	block := &Block{
+		Header: wire.BlockHeader{
+			Version:    1,
+			PrevBlock:  prevBlock,
+			MerkleRoot: bump.MerkleRoot(txids),
+			Timestamp:  uint32(time.Now().Unix()),
+			Bits:       0x207fffff,
+		},
+		Height: height,
+		TxIDs:  txids,
+	}
+	block.Hash = *block.Header.BlockHash()
+	s.blocks = append(s.blocks, block)
+
+	for index, txid := range s.mempool {
+		tx := s.txs[txid]
+
+		blockHash := block.Hash
+		merklePath := merklePaths[index]
+		tx.BlockHash = &blockHash
+		tx.BlockHeight = height
+		tx.MerklePath = &merklePath
+		tx.Position = len(tx.Progression) // progression is complete once mined
+		s.setStatus(tx, arc.TxStatusMined)
+	}
+
+	s.mempool = nil
+	return block, nil
+}
+
+// Blocks returns the blocks that have been mined.
+func (s *Server) Blocks() []*Block {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := make([]*Block, len(s.blocks))
+	copy(result, s.blocks)
+	return result
+}
+
+// addToMempool validates the tx against the policy and the UTXO set and adds it to the mempool.
+// When the tx spends outputs that are unknown to the server, and that aren't provided by the
+// extended format, the tx is held in the orphan mempool until its parents are submitted. The lock
+// must be held by the caller.
+func (s *Server) addToMempool(tx *Tx) *arc.ErrorData {
+	msgTx := tx.Tx.Tx
+
+	size := msgTx.SerializeSize()
+	if s.policy.Policy.MaxTxSize > 0 && size > s.policy.Policy.MaxTxSize {
+		return newErrorData(474, fmt.Sprintf("tx size %d is over maximum %d", size,
+			s.policy.Policy.MaxTxSize), tx.TxID)
+	}
+
+	if s.policy.Policy.MaxScriptSize > 0 {
+		for index, input := range msgTx.TxIn {
+			if len(input.UnlockingScript) > s.policy.Policy.MaxScriptSize {
+				return newErrorData(461, fmt.Sprintf("input %d script size %d is over maximum %d",
+					index, len(input.UnlockingScript), s.policy.Policy.MaxScriptSize), tx.TxID)
+			}
+		}
+
+		for index, output := range msgTx.TxOut {
+			if len(output.LockingScript) > s.policy.Policy.MaxScriptSize {
+				return newErrorData(461, fmt.Sprintf("output %d script size %d is over maximum %d",
+					index, len(output.LockingScript), s.policy.Policy.MaxScriptSize), tx.TxID)
+			}
+		}
+	}
+
+	if s.policy.Policy.MaxTxSigOpsCount > 0 {
+		if count := sigOpCount(msgTx); count > s.policy.Policy.MaxTxSigOpsCount {
+			return newErrorData(461, fmt.Sprintf("sig op count %d is over maximum %d", count,
+				s.policy.Policy.MaxTxSigOpsCount), tx.TxID)
+		}
+	}
+
+	if len(msgTx.TxIn) == 0 {
+		return newErrorData(461, "tx has no inputs", tx.TxID)
+	}
+
+	inputValue := uint64(0)
+	missing := false
+	for index, input := range msgTx.TxIn {
+		if input.PreviousOutPoint.Hash.IsZero() {
+			return newErrorData(461, fmt.Sprintf("input %d is coinbase", index), tx.TxID)
+		}
+
+		if output, exists := s.utxos[input.PreviousOutPoint]; exists {
+			if output.spentBy != nil && !output.spentBy.Equal(&tx.TxID) {
+				return newErrorData(466, fmt.Sprintf("input %d already spent by %s", index,
+					output.spentBy), tx.TxID)
+			}
+
+			inputValue += output.value
+			continue
+		}
+
+		if parent, exists := s.txs[input.PreviousOutPoint.Hash]; exists &&
+			parent.Status != arc.TxStatusOrphaned {
+			return newErrorData(462, fmt.Sprintf("input %d spends missing output %s", index,
+				input.PreviousOutPoint), tx.TxID)
+		}
+
+		if index < len(tx.Tx.SpentOutputs) && tx.Tx.SpentOutputs[index] != nil {
+			inputValue += tx.Tx.SpentOutputs[index].Value
+			continue
+		}
+
+		missing = true
+	}
+
+	if missing {
+		if tx.Status != arc.TxStatusOrphaned {
+			tx.Status = arc.TxStatusOrphaned
+			s.orphans = append(s.orphans, tx.TxID)
+		}
+		return nil
+	}
+
+	outputValue := uint64(0)
+	for _, output := range msgTx.TxOut {
+		outputValue += output.Value
+	}
+
+	if outputValue > inputValue {
+		return newErrorData(462, fmt.Sprintf("outputs %d are more than inputs %d", outputValue,
+			inputValue), tx.TxID)
+	}
+
+	if !tx.SkipFeeValidation && s.policy.Policy.MiningFee.Bytes > 0 {
+		fee := inputValue - outputValue
+		requiredFee := uint64(size) * s.policy.Policy.MiningFee.Satoshis /
+			s.policy.Policy.MiningFee.Bytes
+		if fee < requiredFee {
+			return newErrorData(465, fmt.Sprintf("fee %d is less than required %d", fee,
+				requiredFee), tx.TxID)
+		}
+	}
+
+	s.accept(tx)
+	return nil
+}
+
+// accept updates the UTXO set with the tx and starts its status progression. Any orphans that
+// spend the tx are then added to the mempool. The lock must be held by the caller.
+func (s *Server) accept(tx *Tx) {
+	txid := tx.TxID
+	for index, input := range tx.Tx.Tx.TxIn {
+		output, exists := s.utxos[input.PreviousOutPoint]
+		if !exists {
+			output = &utxo{
+				value: tx.Tx.SpentOutputs[index].Value,
+			}
+			s.utxos[input.PreviousOutPoint] = output
+		}
+
+		output.spentBy = &txid
+	}
+
+	for index, output := range tx.Tx.Tx.TxOut {
+		s.utxos[wire.OutPoint{Hash: txid, Index: uint32(index)}] = &utxo{
+			value: output.Value,
+		}
+	}
+
+	s.mempool = append(s.mempool, txid)
+
+	progression, exists := s.progressions[txid]
+	if !exists {
+		progression = s.defaultProgression
+	}
+	tx.Progression = progression
+	tx.Position = 0
+
+	wasOrphan := tx.Status == arc.TxStatusOrphaned
+	if len(progression) > 0 {
+		if wasOrphan {
+			s.setStatus(tx, progression[0])
+		} else {
+			tx.Status = progression[0]
+		}
+	}
+
+	if wasOrphan {
+		s.removeOrphan(txid)
+	}
+
+	s.resolveOrphans(txid)
+}
+
+// resolveOrphans retries adding the orphans that spend the tx to the mempool. Orphans that are now
+// invalid are rejected. The lock must be held by the caller.
+func (s *Server) resolveOrphans(parentTxID bitcoin.Hash32) {
+	orphans := make([]bitcoin.Hash32, len(s.orphans))
+	copy(orphans, s.orphans)
+
+	for _, orphanTxID := range orphans {
+		orphan := s.txs[orphanTxID]
+		if orphan == nil || orphan.Status != arc.TxStatusOrphaned {
+			continue
+		}
+
+		spendsParent := false
+		for _, input := range orphan.Tx.Tx.TxIn {
+			if input.PreviousOutPoint.Hash.Equal(&parentTxID) {
+				spendsParent = true
+				break
+			}
+		}
+
+		if !spendsParent {
+			continue
+		}
+
+		if errorData := s.addToMempool(orphan); errorData != nil {
+			s.removeOrphan(orphanTxID)
+			orphan.ExtraInfo = &errorData.Detail
+			s.setStatus(orphan, arc.TxStatusRejected)
+		}
+	}
+}
+
+func (s *Server) removeOrphan(txid bitcoin.Hash32) {
+	for i, orphan := range s.orphans {
+		if orphan.Equal(&txid) {
+			s.orphans = append(s.orphans[:i], s.orphans[i+1:]...)
+			return
+		}
+	}
+}
+
+// sigOpCount returns the number of signature operations in the unlocking scripts of the inputs and
+// the locking scripts of the outputs. Multi-sig operations count as the number of public keys when
+// it is pushed immediately before them and as 20 otherwise.
+func sigOpCount(tx *wire.MsgTx) int {
+	result := 0
+	for _, input := range tx.TxIn {
+		result += scriptSigOpCount(input.UnlockingScript)
+	}
+
+	for _, output := range tx.TxOut {
+		result += scriptSigOpCount(output.LockingScript)
+	}
+
+	return result
+}
+
+func scriptSigOpCount(script bitcoin.Script) int {
+	result := 0
+	var previous byte
+	buf := bytes.NewReader(script)
+	for buf.Len() > 0 {
+		item, err := bitcoin.ParseScript(buf)
+		if err != nil {
+			break // the rest of the script is a malformed push
+		}
+
+		if item.Type != bitcoin.ScriptItemTypeOpCode {
+			previous = 0
+			continue
+		}
+
+		switch item.OpCode {
+		case bitcoin.OP_CHECKSIG, bitcoin.OP_CHECKSIGVERIFY:
+			result++
+		case bitcoin.OP_CHECKMULTISIG, bitcoin.OP_CHECKMULTISIGVERIFY:
+			if previous >= bitcoin.OP_1 && previous <= bitcoin.OP_16 {
+				result += int(previous-bitcoin.OP_1) + 1
+			} else {
+				result += 20
+			}
+		}
+
+		previous = item.OpCode
+	}
+
+	return result
+}
+
+func newErrorData(status int, detail string, txid bitcoin.Hash32) *arc.ErrorData {
+	return &arc.ErrorData{
+		Type:   fmt.Sprintf("https://bitcoin-sv.github.io/arc/#/errors?id=_%d", status),
+		Title:  statusTitle(status),
+		Status: status,
+		Detail: detail,
+		TxID:   &txid,
+	}
+}
+
+// statusTitle returns the title ARC uses for the HTTP status.
+func statusTitle(status int) string {
+	switch status {
+	case 460:
+		return "Not extended format"
+	case 461:
+		return "Malformed transaction"
+	case 462:
+		return "Invalid inputs"
+	case 463:
+		return "Malformed transaction"
+	case 464:
+		return "Invalid outputs"
+	case 465:
+		return "Fee too low"
+	case 466:
+		return "Conflicting tx found"
+	case 467:
+		return "Mined ancestors not found"
+	case 468:
+		return "Invalid BUMPs"
+	case 469:
+		return "Invalid Merkle Roots"
+	case 471:
+		return "Input Frozen"
+	case 472:
+		return "Input Frozen"
+	case 473:
+		return "Cumulative Fee validation failed"
+	case 474:
+		return "Transaction is too large"
+	default:
+		if title := http.StatusText(status); len(title) > 0 {
+			return title
+		}
+		return fmt.Sprintf("Status %d", status)
+	}
+}
@@ -0,0 +1,320 @@
+package arctest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/tokenized/arc"
+	"github.com/tokenized/arc/internal/txtest"
+	"github.com/tokenized/arc/pkg/beef"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+func testChildTx(parent *wire.MsgTx, index uint32, value uint64) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(parent.TxHash(), index), nil))
+	key, _ := bitcoin.GenerateKey(bitcoin.MainNet)
+	lockingScript, _ := key.LockingScript()
+	tx.AddTxOut(wire.NewTxOut(value, lockingScript))
+	return tx
+}
+
+func Test_Server_Mempool(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	config := arc.DefaultConfig()
+	client := arc.NewHTTPClient(server.URL(), "", "", config)
+	ctx := context.Background()
+
+	parent := txtest.NewExpandedTx(1, 9990)
+	parentTxID := parent.TxID()
+
+	// Submit the child as a raw tx before the parent so it is orphaned.
+	child := testChildTx(parent.Tx, 0, 9980)
+	childTxID := *child.TxHash()
+	buf := &bytes.Buffer{}
+	child.Serialize(buf)
+
+	response, err := client.SubmitTxBytes(ctx, buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to submit child : %s", err)
+	}
+
+	if response.TxStatus != arc.TxStatusOrphaned {
+		t.Fatalf("Wrong child status : got %s, want %s", response.TxStatus,
+			arc.TxStatusOrphaned)
+	}
+
+	if _, err := client.SubmitTx(ctx, parent); err != nil {
+		t.Fatalf("Failed to submit parent : %s", err)
+	}
+
+	if status := server.Tx(childTxID).Status; status != arc.TxStatusReceived {
+		t.Fatalf("Wrong child status after parent : got %s, want %s", status,
+			arc.TxStatusReceived)
+	}
+
+	// Spend the parent's output again.
+	doubleSpend := testChildTx(parent.Tx, 0, 9970)
+	_, err = client.SubmitTx(ctx, &expanded_tx.ExpandedTx{
+		Tx: doubleSpend,
+		Ancestors: expanded_tx.AncestorTxs{
+			{
+				Tx: parent.Tx,
+			},
+		},
+	})
+	if !errors.Is(err, arc.ErrConflictingTx) {
+		t.Fatalf("Wrong double spend error : got %v, want %s", err, arc.ErrConflictingTx)
+	}
+	t.Logf("Double spend error : %s", err)
+
+	block, err := server.MineBlock()
+	if err != nil {
+		t.Fatalf("Failed to mine block : %s", err)
+	}
+	t.Logf("Mined block %d : %s", block.Height, block.Hash)
+
+	if len(block.TxIDs) != 3 {
+		t.Fatalf("Wrong block tx count : got %d, want %d", len(block.TxIDs), 3)
+	}
+
+	for _, txid := range []bitcoin.Hash32{parentTxID, childTxID} {
+		statusResponse, err := client.GetTxStatus(ctx, txid)
+		if err != nil {
+			t.Fatalf("Failed to get tx status : %s", err)
+		}
+
+		if statusResponse.TxStatus != arc.TxStatusMined {
+			t.Fatalf("Wrong tx status : got %s, want %s", statusResponse.TxStatus,
+				arc.TxStatusMined)
+		}
+
+		if !statusResponse.BlockHash.Equal(&block.Hash) {
+			t.Fatalf("Wrong block hash : got %s, want %s", statusResponse.BlockHash, block.Hash)
+		}
+
+		if statusResponse.MerklePath == nil {
+			t.Fatalf("Missing merkle path")
+		}
+		t.Logf("Merkle path : %s", *statusResponse.MerklePath)
+
+		path, err := statusResponse.ParseMerklePath()
+		if err != nil {
+			t.Fatalf("Failed to parse merkle path : %s", err)
+		}
+
+		if path.BlockHeight != uint64(block.Height) {
+			t.Fatalf("Wrong merkle path height : got %d, want %d", path.BlockHeight,
+				block.Height)
+		}
+
+		root, err := path.ComputeRoot(txid)
+		if err != nil {
+			t.Fatalf("Failed to compute merkle root : %s", err)
+		}
+
+		if !root.Equal(&block.Header.MerkleRoot) {
+			t.Fatalf("Wrong merkle root : got %s, want %s", root, block.Header.MerkleRoot)
+		}
+	}
+}
+
+func Test_Server_Policy(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.SetPolicy(arc.Policy{
+		Policy: arc.PolicyData{
+			MaxScriptSize:    100,
+			MaxTxSize:        1000,
+			MaxTxSigOpsCount: 2,
+			MiningFee: arc.MiningFee{
+				Satoshis: 1,
+				Bytes:    1,
+			},
+		},
+	})
+
+	config := arc.DefaultConfig()
+	client := arc.NewHTTPClient(server.URL(), "", "", config)
+	ctx := context.Background()
+
+	etx := txtest.NewExpandedTx(1, 9990) // pays a 10 satoshi fee
+	if _, err := client.SubmitTx(ctx, etx); !errors.Is(err, arc.ErrFeeTooLow) {
+		t.Fatalf("Wrong fee error : got %v, want %s", err, arc.ErrFeeTooLow)
+	}
+
+	etx.Tx.TxOut[0].Value = 9000
+	if _, err := client.SubmitTx(ctx, etx); err != nil {
+		t.Fatalf("Failed to submit tx : %s", err)
+	}
+
+	etx = txtest.NewExpandedTx(1, 9990)
+	etx.Tx.TxOut[0].Value = 5000
+	etx.Tx.AddTxOut(wire.NewTxOut(0, make([]byte, 1000)))
+	if _, err := client.SubmitTx(ctx, etx); !errors.Is(err, arc.ErrTxTooLarge) {
+		t.Fatalf("Wrong size error : got %v, want %s", err, arc.ErrTxTooLarge)
+	}
+
+	// A 2 of 2 multi-sig output and a P2PKH output have 3 sig ops.
+	etx = txtest.NewExpandedTx(1, 9990)
+	etx.Tx.TxOut[0].Value = 5000
+	etx.Tx.AddTxOut(wire.NewTxOut(0, bitcoin.Script{bitcoin.OP_2, bitcoin.OP_2,
+		bitcoin.OP_CHECKMULTISIG}))
+	if _, err := client.SubmitTx(ctx, etx); !errors.Is(err, arc.ErrMalformedTx) {
+		t.Fatalf("Wrong sig op error : got %v, want %s", err, arc.ErrMalformedTx)
+	}
+}
+
+func Test_Server_AttachMerkleProof(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	receiver := newCallbackReceiver()
+	defer receiver.server.Close()
+
+	config := arc.DefaultConfig()
+	client := arc.NewHTTPClient(server.URL(), "", receiver.server.URL, config)
+	ctx := context.Background()
+
+	parent := txtest.NewExpandedTx(1, 9990)
+	child := &expanded_tx.ExpandedTx{
+		Tx:        testChildTx(parent.Tx, 0, 9980),
+		Ancestors: expanded_tx.AncestorTxs{{Tx: parent.Tx}},
+	}
+
+	for _, etx := range []*expanded_tx.ExpandedTx{parent, child} {
+		if _, err := client.SubmitTx(ctx, etx); err != nil {
+			t.Fatalf("Failed to submit tx : %s", err)
+		}
+	}
+
+	block, err := server.MineBlock()
+	if err != nil {
+		t.Fatalf("Failed to mine block : %s", err)
+	}
+	server.WaitForCallbacks()
+
+	receiver.lock.Lock()
+	callbacks := receiver.callbacks
+	receiver.lock.Unlock()
+
+	if len(callbacks) != 2 {
+		t.Fatalf("Wrong callback count : got %d, want %d", len(callbacks), 2)
+	}
+
+	for _, callback := range callbacks {
+		if *callback.TxStatus != arc.TxStatusMined {
+			t.Fatalf("Wrong callback status : got %s, want %s", *callback.TxStatus,
+				arc.TxStatusMined)
+		}
+
+		added, err := callback.AttachMerkleProof(child)
+		if err != nil {
+			t.Fatalf("Failed to attach merkle proof : %s", err)
+		}
+
+		if !added {
+			t.Fatalf("Merkle proof should be added")
+		}
+
+		added, err = callback.AttachMerkleProof(child)
+		if err != nil {
+			t.Fatalf("Failed to attach merkle proof again : %s", err)
+		}
+
+		if added {
+			t.Fatalf("Merkle proof should not be added twice")
+		}
+	}
+
+	proofs := append(child.MerkleProofs, child.Ancestors[0].MerkleProofs...)
+	if len(proofs) != 2 {
+		t.Fatalf("Wrong merkle proof count : got %d, want %d", len(proofs), 2)
+	}
+
+	for _, proof := range proofs {
+		if !proof.GetBlockHash().Equal(&block.Hash) {
+			t.Fatalf("Wrong merkle proof block hash : got %s, want %s", proof.GetBlockHash(),
+				block.Hash)
+		}
+
+		header := block.Header
+		proof.BlockHeader = &header
+		if err := proof.Verify(); err != nil {
+			t.Fatalf("Failed to verify merkle proof : %s", err)
+		}
+	}
+
+	_, err = callbacks[0].AttachMerkleProof(&expanded_tx.ExpandedTx{Tx: wire.NewMsgTx(1)})
+	if !errors.Is(err, arc.ErrTxNotInExpandedTx) {
+		t.Fatalf("Wrong attach error : got %v, want %s", err, arc.ErrTxNotInExpandedTx)
+	}
+}
+
+func Test_Server_SubmitBEEF(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	config := arc.DefaultConfig()
+	client := arc.NewHTTPClient(server.URL(), "", "", config)
+	ctx := context.Background()
+
+	parent := txtest.NewExpandedTx(1, 9990)
+	if _, err := client.SubmitTx(ctx, parent); err != nil {
+		t.Fatalf("Failed to submit parent : %s", err)
+	}
+
+	block, err := server.MineBlock()
+	if err != nil {
+		t.Fatalf("Failed to mine block : %s", err)
+	}
+	parentResponse, err := client.GetTxStatus(ctx, parent.TxID())
+	if err != nil {
+		t.Fatalf("Failed to get parent status : %s", err)
+	}
+
+	child := &expanded_tx.ExpandedTx{
+		Tx:        testChildTx(parent.Tx, 0, 9980),
+		Ancestors: expanded_tx.AncestorTxs{{Tx: parent.Tx}},
+	}
+	if _, err := parentResponse.AttachMerkleProof(child); err != nil {
+		t.Fatalf("Failed to attach merkle proof : %s", err)
+	}
+
+	heights := beef.BlockHeightMap{block.Hash: uint64(block.Height)}
+	for _, newBeef := range []func(*expanded_tx.ExpandedTx,
+		beef.BlockHeights) (*beef.Beef, error){beef.NewBeef, beef.NewAtomicBeef} {
+
+		b, err := newBeef(child, heights)
+		if err != nil {
+			t.Fatalf("Failed to create beef : %s", err)
+		}
+
+		if len(b.BUMPs) != 1 {
+			t.Fatalf("Wrong bump count : got %d, want %d", len(b.BUMPs), 1)
+		}
+
+		response, err := client.SubmitBEEF(ctx, b)
+		if err != nil {
+			t.Fatalf("Failed to submit beef : %s", err)
+		}
+
+		childTxID := child.TxID()
+		if !response.TxID.Equal(&childTxID) {
+			t.Fatalf("Wrong response txid : got %s, want %s", response.TxID, childTxID)
+		}
+
+		if response.TxStatus != arc.TxStatusReceived {
+			t.Fatalf("Wrong response status : got %s, want %s", response.TxStatus,
+				arc.TxStatusReceived)
+		}
+	}
+}
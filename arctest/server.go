@@ -0,0 +1,847 @@
+package arctest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tokenized/arc"
+	"github.com/tokenized/arc/pkg/beef"
+	"github.com/tokenized/arc/pkg/tef"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrTxNotFound          = errors.New("Tx Not Found")
+	ErrProgressionComplete = errors.New("Progression Complete")
+
+	// DefaultProgression is the status progression used for txs that don't have a progression
+	// specified.
+	DefaultProgression = []arc.TxStatus{
+		arc.TxStatusReceived,
+		arc.TxStatusStored,
+		arc.TxStatusAnnounced,
+		arc.TxStatusSent,
+		arc.TxStatusSeen,
+	}
+)
+
+// Server is an in-process fake ARC server for integration tests. It implements the policy, tx
+// status, and submit endpoints, decodes submitted txs with pkg/tef or pkg/beef, moves each tx
+// through a scripted progression of statuses, and delivers callbacks for status changes. Submitted
+// txs are validated against the policy and a simulated mempool, and blocks can be mined with
+// MineBlock. Scripts are not executed so SkipScriptValidation has no effect.
+type Server struct {
+	server *httptest.Server
+
+	authToken   string
+	callbackURL string
+	policy      arc.Policy
+
+	defaultProgression []arc.TxStatus
+	progressions       map[bitcoin.Hash32][]arc.TxStatus
+	rejections         map[bitcoin.Hash32]*arc.ErrorData
+	txs                map[bitcoin.Hash32]*Tx
+
+	utxos   map[wire.OutPoint]*utxo
+	mempool []bitcoin.Hash32 // accepted txs that are not mined yet
+	orphans []bitcoin.Hash32 // txs waiting for parents
+	blocks  []*Block
+
+	faults []*Fault
+	random *rand.Rand
+
+	// callbacks are queued without blocking so they can be queued while the lock is held.
+	callbacks        []*callbackDelivery
+	callbacksPending int // queued or being delivered
+	callbacksReady   chan interface{}
+	callbacksFlush   chan interface{} // releases a callback held for reordering
+	callbackWaiters  int
+	callbackLock     sync.Mutex
+	callbackCond     *sync.Cond
+
+	deliveredLock    sync.Mutex
+	delivered        []*arc.Callback
+	deliveryErrors   []error
+	callbackClient   *http.Client
+	callbackShutdown chan interface{}
+	callbackComplete chan interface{}
+
+	lock sync.Mutex
+}
+
+// Tx is the state of a tx submitted to the server.
+type Tx struct {
+	Tx       *expanded_tx.ExpandedTx
+	TxID     bitcoin.Hash32
+	Status   arc.TxStatus
+	Position int // index of status in progression
+
+	BlockHash   *bitcoin.Hash32
+	BlockHeight int
+	MerklePath  *string
+	ExtraInfo   *string
+
+	CallbackURL       string
+	CallbackToken     string
+	FullStatusUpdates bool
+	SkipFeeValidation bool
+
+	Progression []arc.TxStatus
+}
+
+type callbackDelivery struct {
+	url      string
+	token    string
+	callback *arc.Callback
+}
+
+// NewServer starts a new fake ARC server. Close must be called to stop it.
+func NewServer() *Server {
+	result := &Server{
+		policy: arc.Policy{
+			Timestamp: time.Now(),
+			Policy: arc.PolicyData{
+				MaxScriptSize:    100000000,
+				MaxTxSigOpsCount: 4294967295,
+				MaxTxSize:        100000000,
+				MiningFee: arc.MiningFee{
+					Satoshis: 1,
+					Bytes:    1000,
+				},
+			},
+		},
+		defaultProgression: DefaultProgression,
+		progressions:       make(map[bitcoin.Hash32][]arc.TxStatus),
+		rejections:         make(map[bitcoin.Hash32]*arc.ErrorData),
+		txs:                make(map[bitcoin.Hash32]*Tx),
+		utxos:              make(map[wire.OutPoint]*utxo),
+		random:             rand.New(rand.NewSource(1)),
+		callbacksReady:     make(chan interface{}, 1),
+		callbacksFlush:     make(chan interface{}, 1),
+		callbackClient:     &http.Client{Timeout: time.Second * 10},
+		callbackShutdown:   make(chan interface{}),
+		callbackComplete:   make(chan interface{}),
+	}
+
+	result.callbackCond = sync.NewCond(&result.callbackLock)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+arc.PathPolicy, result.handleWithFaults(RoutePolicy, result.handlePolicy))
+	mux.HandleFunc("/"+arc.PathSubmitTx, result.handleWithFaults(RouteSubmitTx,
+		result.handleSubmitTx))
+	mux.HandleFunc("/"+arc.PathSubmitTx+"/", result.handleWithFaults(RouteTxStatus,
+		result.handleTxStatus))
+	mux.HandleFunc("/"+arc.PathSubmitTxs, result.handleWithFaults(RouteSubmitTxs,
+		result.handleSubmitTxs))
+
+	result.server = httptest.NewServer(mux)
+	go result.deliverCallbacks()
+
+	return result
+}
+
+// Close stops the server after all pending callbacks are delivered.
+func (s *Server) Close() {
+	s.server.Close()
+	s.WaitForCallbacks()
+	close(s.callbackShutdown)
+	<-s.callbackComplete
+}
+
+// URL returns the base url of the server to be used when creating a client.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// SetAuthToken requires requests to have an Authorization header containing the token.
+func (s *Server) SetAuthToken(token string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.authToken = token
+}
+
+// SetCallbackURL sets a url that all callbacks are delivered to instead of the url in the
+// X-CallbackUrl header of the submission.
+func (s *Server) SetCallbackURL(url string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.callbackURL = url
+}
+
+func (s *Server) SetPolicy(policy arc.Policy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.policy = policy
+}
+
+// SetDefaultProgression sets the statuses that txs without a specific progression move through.
+func (s *Server) SetDefaultProgression(statuses ...arc.TxStatus) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.defaultProgression = statuses
+}
+
+// SetProgression sets the statuses that the tx will move through. The first status is set when the
+// tx is submitted and Advance moves it to the next status.
+func (s *Server) SetProgression(txid bitcoin.Hash32, statuses ...arc.TxStatus) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.progressions[txid] = statuses
+	if tx, exists := s.txs[txid]; exists {
+		tx.Progression = statuses
+		tx.Position = 0
+	}
+}
+
+// RejectSubmit makes submissions of the tx fail with the specified HTTP status, like 465 for fee
+// too low.
+func (s *Server) RejectSubmit(txid bitcoin.Hash32, status int, detail string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.rejections[txid] = newErrorData(status, detail, txid)
+}
+
+// Tx returns a copy of the state of a submitted tx or nil if it hasn't been submitted.
+func (s *Server) Tx(txid bitcoin.Hash32) *Tx {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, exists := s.txs[txid]
+	if !exists {
+		return nil
+	}
+
+	c := *tx
+	return &c
+}
+
+// Advance moves the tx to the next status in its progression and sends a callback. It returns the
+// new status.
+func (s *Server) Advance(txid bitcoin.Hash32) (arc.TxStatus, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, exists := s.txs[txid]
+	if !exists {
+		return arc.TxStatusUnknown, errors.Wrap(ErrTxNotFound, txid.String())
+	}
+
+	if tx.Position+1 >= len(tx.Progression) {
+		return tx.Status, errors.Wrap(ErrProgressionComplete, txid.String())
+	}
+
+	tx.Position++
+	s.setStatus(tx, tx.Progression[tx.Position])
+	return tx.Status, nil
+}
+
+// SetStatus sets the status of a submitted tx and sends a callback.
+func (s *Server) SetStatus(txid bitcoin.Hash32, status arc.TxStatus) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, exists := s.txs[txid]
+	if !exists {
+		return errors.Wrap(ErrTxNotFound, txid.String())
+	}
+
+	s.setStatus(tx, status)
+	return nil
+}
+
+// Callbacks returns the callbacks that have been delivered.
+func (s *Server) Callbacks() []*arc.Callback {
+	s.deliveredLock.Lock()
+	defer s.deliveredLock.Unlock()
+
+	result := make([]*arc.Callback, len(s.delivered))
+	copy(result, s.delivered)
+	return result
+}
+
+// CallbackErrors returns the errors from failed callback deliveries.
+func (s *Server) CallbackErrors() []error {
+	s.deliveredLock.Lock()
+	defer s.deliveredLock.Unlock()
+
+	result := make([]error, len(s.deliveryErrors))
+	copy(result, s.deliveryErrors)
+	return result
+}
+
+// WaitForCallbacks waits until all pending callbacks have been delivered. A callback held by a
+// reorder fault is delivered after any callbacks that are already queued.
+func (s *Server) WaitForCallbacks() {
+	s.callbackLock.Lock()
+	defer s.callbackLock.Unlock()
+
+	s.callbackWaiters++
+	s.flushCallbacks()
+
+	for s.callbacksPending > 0 {
+		s.callbackCond.Wait()
+	}
+
+	s.callbackWaiters--
+}
+
+// flushCallbacks notifies the delivery goroutine to release a held callback.
+func (s *Server) flushCallbacks() {
+	select {
+	case s.callbacksFlush <- nil:
+	default: // the delivery goroutine has already been notified
+	}
+}
+
+func (s *Server) handlePolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+
+	if !s.authorized(w, r) {
+		return
+	}
+
+	s.lock.Lock()
+	policy := s.policy
+	s.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+func (s *Server) handleTxStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+
+	if !s.authorized(w, r) {
+		return
+	}
+
+	txid, err := bitcoin.NewHash32FromStr(strings.TrimPrefix(r.URL.Path,
+		"/"+arc.PathSubmitTx+"/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid txid", nil)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, exists := s.txs[*txid]
+	if !exists {
+		writeError(w, http.StatusNotFound, "transaction not found", txid)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tx.statusResponse())
+}
+
+func (s *Server) handleSubmitTx(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+
+	if !s.authorized(w, r) {
+		return
+	}
+
+	etxs, err := decodeRequest(r, s.txLimits())
+	if err != nil {
+		writeError(w, decodeErrorStatus(err), err.Error(), nil)
+		return
+	}
+
+	if len(etxs) != 1 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%d txs in request", len(etxs)), nil)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	response, errorData := s.submit(etxs[0], r.Header)
+	if errorData != nil {
+		writeJSON(w, errorData.Status, errorData)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleSubmitTxs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+
+	if !s.authorized(w, r) {
+		return
+	}
+
+	etxs, err := decodeRequest(r, s.txLimits())
+	if err != nil {
+		writeError(w, decodeErrorStatus(err), err.Error(), nil)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var responses []*arc.TxSubmitResponse
+	for _, etx := range etxs {
+		response, errorData := s.submit(etx, r.Header)
+		if errorData != nil {
+			// Batch responses contain the error for the tx instead of failing the request.
+			response = &arc.TxSubmitResponse{
+				Timestamp: time.Now(),
+				Status:    errorData.Status,
+				Title:     errorData.Title,
+				TxID:      etx.TxID(),
+				TxStatus:  arc.TxStatusRejected,
+				ExtraInfo: &errorData.Detail,
+			}
+		}
+
+		responses = append(responses, response)
+	}
+
+	writeJSON(w, http.StatusOK, responses)
+}
+
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	s.lock.Lock()
+	authToken := s.authToken
+	s.lock.Unlock()
+
+	if len(authToken) == 0 {
+		return true
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == authToken || header == "Bearer "+authToken {
+		return true
+	}
+
+	writeError(w, http.StatusUnauthorized, "invalid auth token", nil)
+	return false
+}
+
+// submit adds the tx and returns the response. The lock must be held by the caller.
+func (s *Server) submit(etx *expanded_tx.ExpandedTx,
+	header http.Header) (*arc.TxSubmitResponse, *arc.ErrorData) {
+
+	txid := etx.TxID()
+
+	if errorData, exists := s.rejections[txid]; exists {
+		return nil, errorData
+	}
+
+	tx, exists := s.txs[txid]
+	if !exists {
+		tx = &Tx{
+			Tx:                etx,
+			TxID:              txid,
+			SkipFeeValidation: header.Get(arc.HeaderKeySkipFeeValidation) == "true",
+		}
+
+		if errorData := s.addToMempool(tx); errorData != nil {
+			return nil, errorData
+		}
+
+		s.txs[txid] = tx
+	}
+
+	if callbackURL := header.Get(arc.HeaderKeyCallbackURL); len(callbackURL) > 0 {
+		tx.CallbackURL = callbackURL
+		tx.CallbackToken = header.Get(arc.HeaderKeyCallbackToken)
+		tx.FullStatusUpdates = header.Get(arc.HeaderKeyFullStatusUpdates) == "true"
+	}
+
+	if value := header.Get(arc.HeaderKeyWaitForStatus); len(value) > 0 {
+		if waitFor, err := strconv.Atoi(value); err == nil {
+			s.advanceTo(tx, arc.TxStatus(waitFor))
+		}
+	}
+
+	return tx.submitResponse(), nil
+}
+
+// advanceTo moves the tx through its progression until it reaches the status or the progression
+// ends. The lock must be held by the caller.
+func (s *Server) advanceTo(tx *Tx, waitFor arc.TxStatus) {
+	for !tx.Status.AtLeast(waitFor) && !tx.Status.IsTerminal() &&
+		tx.Position+1 < len(tx.Progression) {
+		tx.Position++
+		s.setStatus(tx, tx.Progression[tx.Position])
+	}
+}
+
+// setStatus updates the status of the tx and queues a callback. The lock must be held by the
+// caller.
+func (s *Server) setStatus(tx *Tx, status arc.TxStatus) {
+	tx.Status = status
+
+	if len(tx.CallbackURL) == 0 {
+		return
+	}
+
+	if !tx.FullStatusUpdates {
+		switch status {
+		case arc.TxStatusMined, arc.TxStatusConfirmed, arc.TxStatusRejected,
+			arc.TxStatusOrphaned:
+		default:
+			return // only final statuses without full status updates
+		}
+	}
+
+	url := tx.CallbackURL
+	if len(s.callbackURL) > 0 {
+		url = s.callbackURL
+	}
+
+	s.queueCallback(url, tx.CallbackToken, tx.callback())
+}
+
+// queueCallback adds a callback to the delivery queue. It doesn't block so it can be called while
+// the lock is held.
+func (s *Server) queueCallback(url, token string, callback *arc.Callback) {
+	s.callbackLock.Lock()
+	s.callbacks = append(s.callbacks, &callbackDelivery{
+		url:      url,
+		token:    token,
+		callback: callback,
+	})
+	s.callbacksPending++
+	s.callbackLock.Unlock()
+
+	select {
+	case s.callbacksReady <- nil:
+	default: // the delivery goroutine has already been notified
+	}
+}
+
+// nextCallbacks removes all of the queued callbacks from the queue.
+func (s *Server) nextCallbacks() []*callbackDelivery {
+	s.callbackLock.Lock()
+	defer s.callbackLock.Unlock()
+
+	result := s.callbacks
+	s.callbacks = nil
+	return result
+}
+
+// deliverCallbacks posts queued callbacks in order, unless a callback fault is injected.
+func (s *Server) deliverCallbacks() {
+	defer close(s.callbackComplete)
+
+	var held *callbackDelivery
+	for {
+		select {
+		case <-s.callbacksReady:
+			held = s.deliverQueued(held)
+
+		case <-s.callbacksFlush:
+			// The held callback is still delivered after any queued callbacks.
+			if held = s.deliverQueued(held); held != nil {
+				s.deliver(held)
+				held = nil
+			}
+
+		case <-s.callbackShutdown:
+			return
+		}
+	}
+}
+
+// deliverQueued delivers the queued callbacks and returns the callback that is held by a reorder
+// fault until after the next callback.
+func (s *Server) deliverQueued(held *callbackDelivery) *callbackDelivery {
+	for _, delivery := range s.nextCallbacks() {
+		if held == nil && s.injectCallbackFault(FaultReorderCallback) {
+			held = delivery
+
+			s.callbackLock.Lock()
+			if s.callbackWaiters > 0 {
+				s.flushCallbacks() // release it once the queue is delivered
+			}
+			s.callbackLock.Unlock()
+			continue
+		}
+
+		s.deliver(delivery)
+		if held != nil {
+			s.deliver(held)
+			held = nil
+		}
+	}
+
+	return held
+}
+
+func (s *Server) deliver(delivery *callbackDelivery) {
+	count := 1
+	if s.injectCallbackFault(FaultDuplicateCallback) {
+		count = 2
+	}
+
+	for i := 0; i < count; i++ {
+		err := s.deliverCallback(delivery)
+
+		s.deliveredLock.Lock()
+		if err != nil {
+			s.deliveryErrors = append(s.deliveryErrors, err)
+		} else {
+			s.delivered = append(s.delivered, delivery.callback)
+		}
+		s.deliveredLock.Unlock()
+	}
+
+	s.callbackLock.Lock()
+	s.callbacksPending--
+	if s.callbacksPending == 0 {
+		s.callbackCond.Broadcast()
+	}
+	s.callbackLock.Unlock()
+}
+
+func (s *Server) deliverCallback(delivery *callbackDelivery) error {
+	js, err := json.Marshal(delivery.callback)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+
+	request, err := http.NewRequest(http.MethodPost, delivery.url, bytes.NewReader(js))
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if len(delivery.token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+delivery.token)
+	}
+
+	response, err := s.callbackClient.Do(request)
+	if err != nil {
+		return errors.Wrap(err, "post")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("callback HTTP status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+func (tx Tx) statusResponse() *arc.TxStatusResponse {
+	result := &arc.TxStatusResponse{
+		Timestamp:   time.Now(),
+		BlockHeight: tx.BlockHeight,
+		TxID:        tx.TxID,
+		MerklePath:  tx.MerklePath,
+		TxStatus:    tx.Status,
+		ExtraInfo:   tx.ExtraInfo,
+	}
+
+	if tx.BlockHash != nil {
+		result.BlockHash = *tx.BlockHash
+	}
+
+	return result
+}
+
+func (tx Tx) submitResponse() *arc.TxSubmitResponse {
+	result := &arc.TxSubmitResponse{
+		Timestamp:   time.Now(),
+		BlockHeight: tx.BlockHeight,
+		Status:      http.StatusOK,
+		Title:       "OK",
+		TxID:        tx.TxID,
+		MerklePath:  tx.MerklePath,
+		TxStatus:    tx.Status,
+		ExtraInfo:   tx.ExtraInfo,
+	}
+
+	if tx.BlockHash != nil {
+		result.BlockHash = *tx.BlockHash
+	}
+
+	return result
+}
+
+func (tx Tx) callback() *arc.Callback {
+	now := time.Now()
+	txid := tx.TxID
+	status := tx.Status
+
+	return &arc.Callback{
+		TxID:        &txid,
+		ExtraInfo:   tx.ExtraInfo,
+		Timestamp:   &now,
+		BlockHash:   tx.BlockHash,
+		BlockHeight: tx.BlockHeight,
+		MerklePath:  tx.MerklePath,
+		TxStatus:    &status,
+	}
+}
+
+// txLimits returns the limits of the policy for decoding submitted txs.
+func (s *Server) txLimits() tef.Limits {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.policy.Policy.TxLimits()
+}
+
+// decodeErrorStatus returns the ARC status for a request that failed to decode.
+func decodeErrorStatus(err error) int {
+	if errors.Is(err, tef.ErrLimitExceeded) {
+		return 474 // transaction too large
+	}
+
+	return 460
+}
+
+// decodeRequest decodes the txs in the request body. Binary bodies are decoded as concatenated
+// BEEF, extended, or raw txs, text bodies as hex, and JSON bodies as {"rawTx": hex}.
+func decodeRequest(r *http.Request, limits tef.Limits) ([]*expanded_tx.ExpandedTx, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read body")
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "text/plain"):
+		b, err := hex.DecodeString(strings.TrimSpace(string(body)))
+		if err != nil {
+			return nil, errors.Wrap(err, "hex")
+		}
+		body = b
+
+	case strings.HasPrefix(contentType, "application/json"):
+		var requests []struct {
+			RawTx string `json:"rawTx"`
+		}
+		if len(body) > 0 && body[0] == '[' {
+			if err := json.Unmarshal(body, &requests); err != nil {
+				return nil, errors.Wrap(err, "json")
+			}
+		} else {
+			requests = append(requests, struct {
+				RawTx string `json:"rawTx"`
+			}{})
+			if err := json.Unmarshal(body, &requests[0]); err != nil {
+				return nil, errors.Wrap(err, "json")
+			}
+		}
+
+		buf := &bytes.Buffer{}
+		for i, request := range requests {
+			b, err := hex.DecodeString(request.RawTx)
+			if err != nil {
+				return nil, errors.Wrapf(err, "hex %d", i)
+			}
+			buf.Write(b)
+		}
+		body = buf.Bytes()
+	}
+
+	var result []*expanded_tx.ExpandedTx
+	decoder := tef.NewDecoderWithLimits(bytes.NewReader(body), limits)
+	for decoder.More() {
+		var etx *expanded_tx.ExpandedTx
+		if header, _ := decoder.Peek(4); beef.IsBEEF(header) {
+			offset := decoder.Offset()
+			etx, err = decodeBEEF(decoder.Reader())
+			if err != nil {
+				return nil, errors.Wrapf(err, "tx %d at offset %d", decoder.Count(), offset)
+			}
+			decoder.Advance(etx.TxID())
+		} else {
+			etx, err = decoder.Next()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		result = append(result, etx)
+	}
+
+	if err := decoder.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result) == 0 {
+		return nil, errors.New("No txs")
+	}
+
+	return result, nil
+}
+
+// decodeBEEF decodes the subject tx of a BEEF. The outputs it spends are set from its ancestors so
+// they are treated like the spent outputs of the extended format. Unmined ancestors aren't
+// submitted.
+func decodeBEEF(r io.Reader) (*expanded_tx.ExpandedTx, error) {
+	etx, err := beef.Deserialize(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "beef")
+	}
+
+	spentOutputs := make(expanded_tx.Outputs, etx.InputCount())
+	for index := range spentOutputs {
+		output, err := etx.InputOutput(index)
+		if err != nil {
+			return etx, nil // treated as unknown parents
+		}
+
+		spentOutputs[index] = &expanded_tx.Output{
+			Value:         output.Value,
+			LockingScript: output.LockingScript,
+		}
+	}
+	etx.SpentOutputs = spentOutputs
+
+	return etx, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, detail string, txid *bitcoin.Hash32) {
+	writeJSON(w, status, &arc.ErrorData{
+		Type:   fmt.Sprintf("https://bitcoin-sv.github.io/arc/#/errors?id=_%d", status),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		TxID:   txid,
+	})
+}
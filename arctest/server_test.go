@@ -0,0 +1,228 @@
+package arctest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/tokenized/arc"
+	"github.com/tokenized/arc/internal/txtest"
+	"github.com/tokenized/pkg/expanded_tx"
+
+	"github.com/pkg/errors"
+)
+
+type callbackReceiver struct {
+	server    *httptest.Server
+	callbacks []*arc.Callback
+	tokens    []string
+	lock      sync.Mutex
+}
+
+func newCallbackReceiver() *callbackReceiver {
+	result := &callbackReceiver{}
+	result.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+
+		callback := &arc.Callback{}
+		if err := json.NewDecoder(r.Body).Decode(callback); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		result.lock.Lock()
+		result.callbacks = append(result.callbacks, callback)
+		result.tokens = append(result.tokens, r.Header.Get("Authorization"))
+		result.lock.Unlock()
+	}))
+
+	return result
+}
+
+func Test_Server_Submit(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	receiver := newCallbackReceiver()
+	defer receiver.server.Close()
+
+	server.SetAuthToken("auth_token")
+
+	client := arc.NewHTTPClient(server.URL(), "auth_token", "", arc.DefaultConfig())
+	ctx := context.Background()
+
+	if _, err := client.GetPolicy(ctx); err != nil {
+		t.Fatalf("Failed to get policy : %s", err)
+	}
+
+	etx := txtest.NewExpandedTx(1, 9990)
+	txid := etx.TxID()
+	server.SetProgression(txid, arc.TxStatusReceived, arc.TxStatusStored, arc.TxStatusSeen,
+		arc.TxStatusMined)
+
+	response, err := client.SubmitTxWithOptions(ctx, etx, arc.SubmitOptions{
+		CallbackURL:       receiver.server.URL,
+		CallbackToken:     "callback_token",
+		FullStatusUpdates: true,
+		WaitForStatus:     arc.TxStatusStored,
+	})
+	if err != nil {
+		t.Fatalf("Failed to submit tx : %s", err)
+	}
+
+	if !response.TxID.Equal(&txid) {
+		t.Fatalf("Wrong response txid : got %s, want %s", response.TxID, txid)
+	}
+
+	if response.TxStatus != arc.TxStatusStored {
+		t.Fatalf("Wrong response status : got %s, want %s", response.TxStatus,
+			arc.TxStatusStored)
+	}
+
+	for _, want := range []arc.TxStatus{arc.TxStatusSeen, arc.TxStatusMined} {
+		status, err := server.Advance(txid)
+		if err != nil {
+			t.Fatalf("Failed to advance : %s", err)
+		}
+
+		if status != want {
+			t.Fatalf("Wrong advanced status : got %s, want %s", status, want)
+		}
+	}
+
+	if _, err := server.Advance(txid); errors.Cause(err) != ErrProgressionComplete {
+		t.Fatalf("Wrong advance error : got %v, want %s", err, ErrProgressionComplete)
+	}
+
+	statusResponse, err := client.GetTxStatus(ctx, txid)
+	if err != nil {
+		t.Fatalf("Failed to get tx status : %s", err)
+	}
+
+	if statusResponse.TxStatus != arc.TxStatusMined {
+		t.Fatalf("Wrong tx status : got %s, want %s", statusResponse.TxStatus,
+			arc.TxStatusMined)
+	}
+
+	server.WaitForCallbacks()
+
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+
+	wantStatuses := []arc.TxStatus{arc.TxStatusStored, arc.TxStatusSeen, arc.TxStatusMined}
+	if len(receiver.callbacks) != len(wantStatuses) {
+		t.Fatalf("Wrong callback count : got %d, want %d", len(receiver.callbacks),
+			len(wantStatuses))
+	}
+
+	for i, callback := range receiver.callbacks {
+		t.Logf("Callback %d : %s", i, *callback.TxStatus)
+
+		if *callback.TxStatus != wantStatuses[i] {
+			t.Errorf("Wrong callback %d status : got %s, want %s", i, *callback.TxStatus,
+				wantStatuses[i])
+		}
+
+		if receiver.tokens[i] != "Bearer callback_token" {
+			t.Errorf("Wrong callback %d token : got %s, want %s", i, receiver.tokens[i],
+				"Bearer callback_token")
+		}
+	}
+}
+
+func Test_Server_QueueCallbacks(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	receiver := newCallbackReceiver()
+	defer receiver.server.Close()
+
+	// More callbacks than can be delivered immediately are queued while the lock is held and
+	// while other goroutines wait for callbacks.
+	const routines = 10
+	const count = 120
+	var wait sync.WaitGroup
+	for i := 0; i < routines; i++ {
+		wait.Add(2)
+		go func() {
+			defer wait.Done()
+			server.lock.Lock()
+			defer server.lock.Unlock()
+
+			for j := 0; j < count; j++ {
+				server.queueCallback(receiver.server.URL, "", &arc.Callback{})
+			}
+		}()
+
+		go func() {
+			defer wait.Done()
+			server.WaitForCallbacks()
+		}()
+	}
+
+	wait.Wait()
+	server.WaitForCallbacks()
+
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+
+	if len(receiver.callbacks) != routines*count {
+		t.Fatalf("Wrong callback count : got %d, want %d", len(receiver.callbacks),
+			routines*count)
+	}
+}
+
+func Test_Server_Errors(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.SetAuthToken("auth_token")
+
+	ctx := context.Background()
+	config := arc.DefaultConfig()
+
+	client := arc.NewHTTPClient(server.URL(), "wrong_token", "", config)
+	if _, err := client.GetPolicy(ctx); !errors.Is(err, arc.ErrUnauthorized) {
+		t.Fatalf("Wrong policy error : got %v, want %s", err, arc.ErrUnauthorized)
+	}
+
+	client = arc.NewHTTPClient(server.URL(), "auth_token", "", config)
+
+	etx := txtest.NewExpandedTx(1, 9990)
+	txid := etx.TxID()
+
+	if _, err := client.GetTxStatus(ctx, txid); err == nil {
+		t.Fatalf("Tx status should not be found")
+	}
+
+	server.RejectSubmit(txid, 465, "fee too low")
+
+	_, err := client.SubmitTx(ctx, etx)
+	if !errors.Is(err, arc.ErrFeeTooLow) {
+		t.Fatalf("Wrong submit error : got %v, want %s", err, arc.ErrFeeTooLow)
+	}
+	t.Logf("Submit error : %s", err)
+
+	responses, err := client.SubmitTxs(ctx, []expanded_tx.TransactionWithOutputs{etx,
+		txtest.NewExpandedTx(1, 9990)})
+	if err != nil {
+		t.Fatalf("Failed to submit txs : %s", err)
+	}
+
+	if len(responses) != 2 {
+		t.Fatalf("Wrong response count : got %d, want %d", len(responses), 2)
+	}
+
+	if responses[0].TxStatus != arc.TxStatusRejected {
+		t.Errorf("Wrong first tx status : got %s, want %s", responses[0].TxStatus,
+			arc.TxStatusRejected)
+	}
+
+	if responses[1].TxStatus != arc.TxStatusReceived {
+		t.Errorf("Wrong second tx status : got %s, want %s", responses[1].TxStatus,
+			arc.TxStatusReceived)
+	}
+}
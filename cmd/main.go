@@ -18,7 +18,6 @@ import (
 	"github.com/tokenized/config"
 	"github.com/tokenized/logger"
 	"github.com/tokenized/pkg/bitcoin"
-	"github.com/tokenized/pkg/expanded_tx"
 	"github.com/tokenized/pkg/peer_channels"
 	"github.com/tokenized/threads"
 
@@ -116,21 +115,22 @@ func Submit(ctx context.Context, cfg *Config, args []string) error {
 		return errors.Wrap(err, "decode hex")
 	}
 
-	r := bytes.NewReader(b)
-	var etxs []*expanded_tx.ExpandedTx
-
-	for {
-		etx, err := tef.Deserialize(r)
+	decoder := tef.NewDecoder(bytes.NewReader(b))
+	for decoder.More() {
+		etx, err := decoder.Next()
 		if err != nil {
 			return errors.Wrap(err, "deserialize etx")
 		}
 
-		fmt.Printf("Tx : %s\n", etx)
-		etxs = append(etxs, etx)
+		fmt.Printf("Tx %s : %s\n", decoder.TxID(), etx)
+	}
 
-		if r.Len() == 0 {
-			break
-		}
+	if err := decoder.Err(); err != nil {
+		return errors.Wrap(err, "deserialize etx")
+	}
+
+	if decoder.Count() == 0 {
+		return errors.New("No txs")
 	}
 
 	factory := arc.NewFactory(cfg.Factory)
@@ -0,0 +1,498 @@
+package arc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// timeFormats are the timestamp formats accepted from ARC, in addition to unix seconds.
+	timeFormats = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05.999999999",
+		time.RFC1123,
+		time.RFC1123Z,
+	}
+)
+
+// lenientDecoder decodes the fields of a JSON object without failing on fields that can't be
+// decoded. Fields that aren't requested, or that fail to decode, are kept so they aren't lost.
+type lenientDecoder struct {
+	fields map[string]json.RawMessage
+	failed map[string]json.RawMessage
+}
+
+func newLenientDecoder(data []byte) (*lenientDecoder, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.Wrap(err, "object")
+	}
+
+	return &lenientDecoder{
+		fields: fields,
+		failed: make(map[string]json.RawMessage),
+	}, nil
+}
+
+// take removes the field and returns its value. It returns false when the field is missing or
+// null. Keys are matched case insensitively like encoding/json.
+func (d *lenientDecoder) take(key string) (json.RawMessage, bool) {
+	value, exists := d.fields[key]
+	if !exists {
+		for k, v := range d.fields {
+			if strings.EqualFold(k, key) {
+				key = k
+				value = v
+				exists = true
+				break
+			}
+		}
+	}
+
+	if !exists {
+		return nil, false
+	}
+
+	delete(d.fields, key)
+	if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+		return nil, false
+	}
+
+	return value, true
+}
+
+func (d *lenientDecoder) fail(key string, value json.RawMessage) {
+	d.failed[key] = value
+}
+
+// remaining returns the fields that weren't decoded or that failed to decode. It returns nil when
+// there are none.
+func (d *lenientDecoder) remaining() map[string]json.RawMessage {
+	if len(d.fields) == 0 && len(d.failed) == 0 {
+		return nil
+	}
+
+	result := make(map[string]json.RawMessage)
+	for k, v := range d.fields {
+		result[k] = v
+	}
+	for k, v := range d.failed {
+		result[k] = v
+	}
+
+	return result
+}
+
+func (d *lenientDecoder) string(key string, v *string) {
+	value, ok := d.take(key)
+	if !ok {
+		return
+	}
+
+	if err := json.Unmarshal(value, v); err != nil {
+		d.fail(key, value) // numbers and other values are kept raw
+	}
+}
+
+func (d *lenientDecoder) stringPtr(key string, v **string) {
+	value, ok := d.take(key)
+	if !ok {
+		return
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		d.fail(key, value)
+		return
+	}
+
+	*v = &s
+}
+
+// int decodes a number or a string containing a number.
+func (d *lenientDecoder) int(key string, v *int) {
+	value, ok := d.take(key)
+	if !ok {
+		return
+	}
+
+	i, ok := parseInt(value)
+	if !ok {
+		d.fail(key, value)
+		return
+	}
+
+	*v = int(i)
+}
+
+// hash decodes a hex hash. Empty strings are left as the zero hash.
+func (d *lenientDecoder) hash(key string, v *bitcoin.Hash32) {
+	value, ok := d.take(key)
+	if !ok {
+		return
+	}
+
+	hash, ok := parseHash(value)
+	if !ok {
+		d.fail(key, value)
+		return
+	}
+
+	if hash != nil {
+		*v = *hash
+	}
+}
+
+// hashPtr decodes a hex hash. Empty strings are left as nil.
+func (d *lenientDecoder) hashPtr(key string, v **bitcoin.Hash32) {
+	value, ok := d.take(key)
+	if !ok {
+		return
+	}
+
+	hash, ok := parseHash(value)
+	if !ok {
+		d.fail(key, value)
+		return
+	}
+
+	*v = hash
+}
+
+// hashes decodes a list of hex hashes. Empty strings in the list are skipped.
+func (d *lenientDecoder) hashes(key string, v *[]bitcoin.Hash32) {
+	value, ok := d.take(key)
+	if !ok {
+		return
+	}
+
+	var values []json.RawMessage
+	if err := json.Unmarshal(value, &values); err != nil {
+		d.fail(key, value)
+		return
+	}
+
+	var result []bitcoin.Hash32
+	for _, item := range values {
+		hash, ok := parseHash(item)
+		if !ok {
+			d.fail(key, value)
+			return
+		}
+
+		if hash != nil {
+			result = append(result, *hash)
+		}
+	}
+
+	*v = result
+}
+
+func (d *lenientDecoder) time(key string, v *time.Time) {
+	value, ok := d.take(key)
+	if !ok {
+		return
+	}
+
+	t, ok := parseTime(value)
+	if !ok {
+		d.fail(key, value)
+		return
+	}
+
+	*v = t
+}
+
+func (d *lenientDecoder) timePtr(key string, v **time.Time) {
+	value, ok := d.take(key)
+	if !ok {
+		return
+	}
+
+	t, ok := parseTime(value)
+	if !ok {
+		d.fail(key, value)
+		return
+	}
+
+	if !t.IsZero() {
+		*v = &t
+	}
+}
+
+// txStatus decodes a status name or number. Statuses that aren't recognized are set to
+// TxStatusUnrecognized. The raw text of the status is always returned in raw.
+func (d *lenientDecoder) txStatus(key string, v *TxStatus, raw *string) {
+	value, ok := d.take(key)
+	if !ok {
+		return
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		*raw = s
+		if len(s) == 0 {
+			return
+		}
+
+		if i, err := strconv.ParseUint(s, 10, 32); err == nil {
+			*v = recognizedTxStatus(TxStatus(i))
+			return
+		}
+
+		if err := v.SetString(strings.ToUpper(s)); err != nil {
+			*v = TxStatusUnrecognized
+		}
+		return
+	}
+
+	i, ok := parseInt(value)
+	if !ok || i < 0 {
+		d.fail(key, value)
+		return
+	}
+
+	*raw = string(bytes.TrimSpace(value))
+	*v = recognizedTxStatus(TxStatus(i))
+}
+
+// recognizedTxStatus returns the status of an integer value if it is known, otherwise
+// TxStatusUnrecognized. Statuses that are only decoded from their names are not recognized.
+func recognizedTxStatus(s TxStatus) TxStatus {
+	switch s {
+	case TxStatusDoubleSpendAttempted, TxStatusSeenMultipleNodes, TxStatusMinedInStaleBlock,
+		TxStatusUnrecognized:
+		return TxStatusUnrecognized
+	}
+
+	if len(s.String()) == 0 {
+		return TxStatusUnrecognized
+	}
+
+	return s
+}
+
+func parseInt(value json.RawMessage) (int64, bool) {
+	var n json.Number
+	if err := json.Unmarshal(value, &n); err == nil {
+		if i, err := n.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := n.Float64(); err == nil {
+			return int64(f), true
+		}
+		return 0, false
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return 0, false
+	}
+
+	if len(s) == 0 {
+		return 0, true
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return i, true
+}
+
+// parseHash returns nil for an empty string.
+func parseHash(value json.RawMessage) (*bitcoin.Hash32, bool) {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return nil, false
+	}
+
+	if len(s) == 0 {
+		return nil, true
+	}
+
+	hash, err := bitcoin.NewHash32FromStr(s)
+	if err != nil {
+		return nil, false
+	}
+
+	return hash, true
+}
+
+// parseTime accepts the formats in timeFormats or a number of unix seconds. An empty string is
+// the zero time.
+func parseTime(value json.RawMessage) (time.Time, bool) {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		i, ok := parseInt(value)
+		if !ok {
+			return time.Time{}, false
+		}
+
+		return time.Unix(i, 0), true
+	}
+
+	if len(s) == 0 {
+		return time.Time{}, true
+	}
+
+	for _, format := range timeFormats {
+		if t, err := time.Parse(format, s); err == nil {
+			return t, true
+		}
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(i, 0), true
+	}
+
+	return time.Time{}, false
+}
+
+// MarshalJSON encodes an unrecognized status as the raw text that was received so it isn't lost.
+func (r TxStatusResponse) MarshalJSON() ([]byte, error) {
+	type response TxStatusResponse
+	if r.TxStatus != TxStatusUnrecognized || len(r.RawTxStatus) == 0 {
+		return json.Marshal(response(r))
+	}
+
+	return json.Marshal(struct {
+		response
+		TxStatus json.RawMessage `json:"txStatus"`
+	}{
+		response: response(r),
+		TxStatus: rawTxStatusJSON(r.RawTxStatus),
+	})
+}
+
+// MarshalJSON encodes an unrecognized status as the raw text that was received so it isn't lost.
+func (r TxSubmitResponse) MarshalJSON() ([]byte, error) {
+	type response TxSubmitResponse
+	if r.TxStatus != TxStatusUnrecognized || len(r.RawTxStatus) == 0 {
+		return json.Marshal(response(r))
+	}
+
+	return json.Marshal(struct {
+		response
+		TxStatus json.RawMessage `json:"txStatus"`
+	}{
+		response: response(r),
+		TxStatus: rawTxStatusJSON(r.RawTxStatus),
+	})
+}
+
+// MarshalJSON encodes an unrecognized status as the raw text that was received so it isn't lost.
+func (c Callback) MarshalJSON() ([]byte, error) {
+	type callback Callback
+	if c.TxStatus == nil || *c.TxStatus != TxStatusUnrecognized || len(c.RawTxStatus) == 0 {
+		return json.Marshal(callback(c))
+	}
+
+	return json.Marshal(struct {
+		callback
+		TxStatus json.RawMessage `json:"txStatus"`
+	}{
+		callback: callback(c),
+		TxStatus: rawTxStatusJSON(c.RawTxStatus),
+	})
+}
+
+// rawTxStatusJSON returns the raw status text as a JSON number if it is an integer, otherwise as a
+// JSON string.
+func rawTxStatusJSON(raw string) json.RawMessage {
+	if _, err := strconv.ParseUint(raw, 10, 32); err == nil {
+		return json.RawMessage(raw)
+	}
+
+	js, _ := json.Marshal(raw) // marshalling a string can't fail
+	return js
+}
+
+// UnmarshalJSON decodes the response without failing on fields that can't be decoded. Those
+// fields, and any fields that aren't recognized, are kept in Extra.
+func (r *TxStatusResponse) UnmarshalJSON(data []byte) error {
+	d, err := newLenientDecoder(data)
+	if err != nil {
+		return err
+	}
+
+	*r = TxStatusResponse{}
+	d.time("timestamp", &r.Timestamp)
+	d.hash("blockHash", &r.BlockHash)
+	d.int("blockHeight", &r.BlockHeight)
+	d.hash("txid", &r.TxID)
+	d.stringPtr("merklePath", &r.MerklePath)
+	d.txStatus("txStatus", &r.TxStatus, &r.RawTxStatus)
+	d.stringPtr("extraInfo", &r.ExtraInfo)
+	d.hashes("competingTxs", &r.CompetingTxs)
+	r.Extra = d.remaining()
+
+	return nil
+}
+
+// UnmarshalJSON decodes the response without failing on fields that can't be decoded. Those
+// fields, and any fields that aren't recognized, are kept in Extra.
+func (r *TxSubmitResponse) UnmarshalJSON(data []byte) error {
+	d, err := newLenientDecoder(data)
+	if err != nil {
+		return err
+	}
+
+	*r = TxSubmitResponse{}
+	d.time("timestamp", &r.Timestamp)
+	d.hash("blockHash", &r.BlockHash)
+	d.int("blockHeight", &r.BlockHeight)
+	d.int("status", &r.Status)
+	d.string("title", &r.Title)
+	d.hash("txid", &r.TxID)
+	d.stringPtr("merklePath", &r.MerklePath)
+	d.txStatus("txStatus", &r.TxStatus, &r.RawTxStatus)
+	d.stringPtr("extraInfo", &r.ExtraInfo)
+	d.hashes("competingTxs", &r.CompetingTxs)
+	r.Extra = d.remaining()
+
+	return nil
+}
+
+// UnmarshalJSON decodes the callback without failing on fields that can't be decoded. Those
+// fields, and any fields that aren't recognized, are kept in Extra.
+func (c *Callback) UnmarshalJSON(data []byte) error {
+	d, err := newLenientDecoder(data)
+	if err != nil {
+		return err
+	}
+
+	*c = Callback{}
+	d.string("type", &c.Type)
+	d.string("title", &c.Title)
+	d.int("status", &c.Status)
+	d.string("detail", &c.Detail)
+	d.stringPtr("instance", &c.Instance)
+	d.hashPtr("txid", &c.TxID)
+	d.stringPtr("extraInfo", &c.ExtraInfo)
+	d.timePtr("timestamp", &c.Timestamp)
+	d.hashPtr("blockHash", &c.BlockHash)
+	d.int("blockHeight", &c.BlockHeight)
+	d.stringPtr("merklePath", &c.MerklePath)
+
+	var status TxStatus
+	d.txStatus("txStatus", &status, &c.RawTxStatus)
+	if len(c.RawTxStatus) > 0 {
+		c.TxStatus = &status
+	}
+
+	d.hashes("competingTxs", &c.CompetingTxs)
+	c.Extra = d.remaining()
+
+	return nil
+}
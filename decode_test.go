@@ -0,0 +1,169 @@
+package arc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func Test_Callback_UnmarshalJSON_Lenient(t *testing.T) {
+	js := `{
+		"timestamp": "2024-03-22 16:02:11.123",
+		"txid": "4d76b00f29e480e0a933cef9d9ffe303d6ab919e2cdb265dd2cea41089baa85a",
+		"txStatus": "SOME_NEW_STATUS",
+		"blockHash": "",
+		"blockHeight": "839123",
+		"merklePath": null,
+		"extraInfo": null,
+		"newField": {"a": 1}
+	}`
+
+	callback := &Callback{}
+	if err := json.Unmarshal([]byte(js), callback); err != nil {
+		t.Fatalf("Failed to unmarshal callback : %s", err)
+	}
+
+	if callback.TxStatus == nil || *callback.TxStatus != TxStatusUnrecognized {
+		t.Fatalf("Wrong tx status : got %v, want %s", callback.TxStatus, TxStatusUnrecognized)
+	}
+
+	if callback.RawTxStatus != "SOME_NEW_STATUS" {
+		t.Fatalf("Wrong raw tx status : got %s, want %s", callback.RawTxStatus,
+			"SOME_NEW_STATUS")
+	}
+
+	if callback.BlockHash != nil {
+		t.Fatalf("Block hash should be nil : %s", callback.BlockHash)
+	}
+
+	if callback.BlockHeight != 839123 {
+		t.Fatalf("Wrong block height : got %d, want %d", callback.BlockHeight, 839123)
+	}
+
+	want := time.Date(2024, 3, 22, 16, 2, 11, 123000000, time.UTC)
+	if callback.Timestamp == nil || !callback.Timestamp.Equal(want) {
+		t.Fatalf("Wrong timestamp : got %v, want %s", callback.Timestamp, want)
+	}
+
+	if callback.MerklePath != nil || callback.ExtraInfo != nil {
+		t.Fatalf("Null fields should be nil")
+	}
+
+	if _, exists := callback.Extra["newField"]; !exists {
+		t.Fatalf("Missing unknown field : %v", callback.Extra)
+	}
+}
+
+func Test_TxStatusResponse_UnmarshalJSON_Lenient(t *testing.T) {
+	tests := []struct {
+		name      string
+		js        string
+		status    TxStatus
+		raw       string
+		marshal   string // txStatus when marshalled again
+		extraKeys []string
+	}{
+		{
+			name:    "string",
+			js:      `{"txStatus":"SEEN_ON_NETWORK","timestamp":"2024-03-22T16:02:11Z"}`,
+			status:  TxStatusSeen,
+			raw:     "SEEN_ON_NETWORK",
+			marshal: `"SEEN_ON_NETWORK"`,
+		},
+		{
+			name:    "number",
+			js:      `{"txStatus":9,"timestamp":1711123331}`,
+			status:  TxStatusMined,
+			raw:     "9",
+			marshal: `"MINED"`,
+		},
+		{
+			name:    "numeric string",
+			js:      `{"txStatus":"108","blockHash":null}`,
+			status:  TxStatusConfirmed,
+			raw:     "108",
+			marshal: `"CONFIRMED"`,
+		},
+		{
+			name:    "unknown number",
+			js:      `{"txStatus":120}`,
+			status:  TxStatusUnrecognized,
+			raw:     "120",
+			marshal: `120`,
+		},
+		{
+			name:    "unknown string",
+			js:      `{"txStatus":"SEEN_BY_EVERYONE"}`,
+			status:  TxStatusUnrecognized,
+			raw:     "SEEN_BY_EVERYONE",
+			marshal: `"SEEN_BY_EVERYONE"`,
+		},
+		{
+			name:      "bad fields",
+			js:        `{"txStatus":"STORED","blockHash":"xyz","timestamp":"yesterday"}`,
+			status:    TxStatusStored,
+			raw:       "STORED",
+			marshal:   `"STORED"`,
+			extraKeys: []string{"blockHash", "timestamp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := &TxStatusResponse{}
+			if err := json.Unmarshal([]byte(tt.js), response); err != nil {
+				t.Fatalf("Failed to unmarshal response : %s", err)
+			}
+
+			if response.TxStatus != tt.status {
+				t.Errorf("Wrong tx status : got %s, want %s", response.TxStatus, tt.status)
+			}
+
+			if response.RawTxStatus != tt.raw {
+				t.Errorf("Wrong raw tx status : got %s, want %s", response.RawTxStatus, tt.raw)
+			}
+
+			if len(response.Extra) != len(tt.extraKeys) {
+				t.Errorf("Wrong extra field count : got %d, want %d", len(response.Extra),
+					len(tt.extraKeys))
+			}
+
+			for _, key := range tt.extraKeys {
+				if _, exists := response.Extra[key]; !exists {
+					t.Errorf("Missing extra field %s", key)
+				}
+			}
+
+			js, err := json.Marshal(response)
+			if err != nil {
+				t.Fatalf("Failed to marshal response : %s", err)
+			}
+
+			fields := make(map[string]json.RawMessage)
+			if err := json.Unmarshal(js, &fields); err != nil {
+				t.Fatalf("Failed to unmarshal fields : %s", err)
+			}
+
+			if got := string(fields["txStatus"]); got != tt.marshal {
+				t.Errorf("Wrong marshalled tx status : got %s, want %s", got, tt.marshal)
+			}
+		})
+	}
+}
+
+func Test_TxSubmitResponse_UnmarshalJSON_Array(t *testing.T) {
+	js := `[{"txStatus":"STORED","status":200},{"txStatus":"REJECTED","status":"465"}]`
+
+	var responses []*TxSubmitResponse
+	if err := json.Unmarshal([]byte(js), &responses); err != nil {
+		t.Fatalf("Failed to unmarshal responses : %s", err)
+	}
+
+	if len(responses) != 2 {
+		t.Fatalf("Wrong response count : got %d, want %d", len(responses), 2)
+	}
+
+	if responses[1].TxStatus != TxStatusRejected || responses[1].Status != 465 {
+		t.Fatalf("Wrong second response : %s %d", responses[1].TxStatus, responses[1].Status)
+	}
+}
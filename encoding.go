@@ -0,0 +1,454 @@
+package arc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/tokenized/arc/pkg/beef"
+	"github.com/tokenized/arc/pkg/tef"
+	"github.com/tokenized/pkg/expanded_tx"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// TxFormatDefault uses the tx format of the client config, or the extended format if that is
+	// also default.
+	TxFormatDefault = TxFormat(0)
+
+	// TxFormatExtended is the extended format (BRC-30) that includes the outputs spent by the
+	// inputs. When the tx doesn't have all of the spent outputs it is submitted as BEEF if that can
+	// be created, otherwise raw.
+	TxFormatExtended = TxFormat(1)
+
+	// TxFormatRaw is the raw tx. ARC must already know the outputs it spends.
+	TxFormatRaw = TxFormat(2)
+
+	// TxFormatBEEF is BRC-62 BEEF containing the tx's ancestors back to mined txs. The ancestors'
+	// merkle proofs must have block hashes that are in the block heights. When BEEF can't be
+	// created because of missing ancestors, merkle proofs, or block heights the tx is submitted in
+	// the extended format, or raw.
+	TxFormatBEEF = TxFormat(3)
+
+	// BodyEncodingDefault uses the body encoding of the client config, or binary if that is also
+	// default.
+	BodyEncodingDefault = BodyEncoding(0)
+
+	// BodyEncodingBinary posts the tx bytes as application/octet-stream.
+	BodyEncodingBinary = BodyEncoding(1)
+
+	// BodyEncodingHex posts the tx bytes as hex text/plain.
+	BodyEncodingHex = BodyEncoding(2)
+
+	// BodyEncodingJSON posts application/json {"rawTx": hex}, or an array of them for batches.
+	BodyEncodingJSON = BodyEncoding(3)
+)
+
+var (
+	ErrInvalidTxFormat     = errors.New("Invalid Tx Format")
+	ErrInvalidBodyEncoding = errors.New("Invalid Body Encoding")
+)
+
+// TxFormat is the format that txs are serialized in when they are submitted.
+type TxFormat uint8
+
+// BodyEncoding is how serialized txs are encoded in the body of submit requests.
+type BodyEncoding uint8
+
+// txsBody is serialized txs for the body of submit requests. When buf is set the txs are in a
+// pooled buffer. It is returned to the pool after the body is released and every request reader
+// has been closed since the http transport can still be reading a request body after the response
+// is returned.
+type txsBody struct {
+	b   []byte   // all of the txs
+	txs [][]byte // each tx, nil when they haven't been split
+	buf *[]byte
+
+	refs int
+	lock sync.Mutex
+}
+
+type txsBodyReader struct {
+	*bytes.Reader
+	body *txsBody
+
+	closed bool
+	lock   sync.Mutex
+}
+
+// txRequest is the JSON body of a submit request.
+type txRequest struct {
+	RawTx string `json:"rawTx"`
+}
+
+// blockHeights wraps the block heights so they can be stored in an atomic.Value.
+type blockHeights struct {
+	heights beef.BlockHeights
+}
+
+// SetBlockHeights sets the block heights used to convert merkle proofs to BUMPs when txs are
+// submitted as BEEF. SubmitOptions.BlockHeights overrides them.
+func (c *HTTPClient) SetBlockHeights(heights beef.BlockHeights) {
+	c.heights.Store(blockHeights{heights: heights})
+}
+
+func (c HTTPClient) txFormat(options SubmitOptions) TxFormat {
+	if options.TxFormat != TxFormatDefault {
+		return options.TxFormat
+	}
+
+	if c.config.TxFormat != TxFormatDefault {
+		return c.config.TxFormat
+	}
+
+	return TxFormatExtended
+}
+
+func (c HTTPClient) bodyEncoding(options SubmitOptions) BodyEncoding {
+	if options.BodyEncoding != BodyEncodingDefault {
+		return options.BodyEncoding
+	}
+
+	if c.config.BodyEncoding != BodyEncodingDefault {
+		return c.config.BodyEncoding
+	}
+
+	return BodyEncodingBinary
+}
+
+func (c HTTPClient) blockHeights(options SubmitOptions) beef.BlockHeights {
+	if options.BlockHeights != nil {
+		return options.BlockHeights
+	}
+
+	if value, ok := c.heights.Load().(blockHeights); ok {
+		return value.heights
+	}
+
+	return nil
+}
+
+// appendTx appends the tx serialized in the format to b. On error b is returned unchanged.
+func appendTx(b []byte, tx expanded_tx.TransactionWithOutputs, format TxFormat,
+	heights beef.BlockHeights) ([]byte, error) {
+
+	switch format {
+	case TxFormatExtended:
+		result, err := tef.AppendSerialize(b, tx)
+		if err == nil {
+			return result, nil
+		}
+		if !errors.Is(err, tef.ErrMissingSpentOutputs) {
+			return b, errors.Wrap(err, "extended")
+		}
+
+		// BEEF doesn't need the spent outputs when the tx or its ancestors are mined.
+		if etx := expandedTx(tx); etx != nil {
+			result, err := appendBEEF(b, etx, heights)
+			if err == nil {
+				return result, nil
+			}
+			if !isBEEFUnavailable(err) {
+				return b, errors.Wrap(err, "beef")
+			}
+		}
+
+		return appendTx(b, tx, TxFormatRaw, heights)
+
+	case TxFormatRaw:
+		buf := bytes.NewBuffer(b)
+		if err := tx.GetMsgTx().Serialize(buf); err != nil {
+			return b, errors.Wrap(err, "raw")
+		}
+		return buf.Bytes(), nil
+
+	case TxFormatBEEF:
+		if etx := expandedTx(tx); etx != nil {
+			result, err := appendBEEF(b, etx, heights)
+			if err == nil {
+				return result, nil
+			}
+			if !isBEEFUnavailable(err) {
+				return b, errors.Wrap(err, "beef")
+			}
+		}
+
+		result, err := tef.AppendSerialize(b, tx)
+		if err == nil {
+			return result, nil
+		}
+		if !errors.Is(err, tef.ErrMissingSpentOutputs) {
+			return b, errors.Wrap(err, "extended")
+		}
+
+		return appendTx(b, tx, TxFormatRaw, heights)
+
+	default:
+		return b, errors.Wrapf(ErrInvalidTxFormat, "%d", format)
+	}
+}
+
+// appendBEEF appends the tx serialized as BEEF to b. On error b is returned unchanged.
+func appendBEEF(b []byte, etx *expanded_tx.ExpandedTx, heights beef.BlockHeights) ([]byte, error) {
+	buf := bytes.NewBuffer(b)
+	if err := beef.Serialize(buf, etx, heights); err != nil {
+		return b, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isBEEFUnavailable returns true if BEEF couldn't be created because of missing ancestors, merkle
+// proofs, or block heights so another format should be used.
+func isBEEFUnavailable(err error) bool {
+	return errors.Is(err, beef.ErrMissingAncestor) || errors.Is(err, beef.ErrBlockNotFound) ||
+		errors.Is(err, beef.ErrMissingBlockHash)
+}
+
+// encodeTxs serializes the txs into a pooled buffer. The result must be released.
+func (c HTTPClient) encodeTxs(txs []expanded_tx.TransactionWithOutputs,
+	options SubmitOptions) (*txsBody, error) {
+
+	format := c.txFormat(options)
+	heights := c.blockHeights(options)
+
+	buf := tef.GetBuffer()
+	b := (*buf)[:0]
+	ends := make([]int, len(txs))
+	for i, tx := range txs {
+		var err error
+		b, err = appendTx(b, tx, format, heights)
+		if err != nil {
+			*buf = b
+			tef.PutBuffer(buf)
+			return nil, errors.Wrapf(err, "tx %d", i)
+		}
+		ends[i] = len(b)
+	}
+	*buf = b
+
+	result := &txsBody{
+		b:    b,
+		txs:  make([][]byte, len(txs)),
+		buf:  buf,
+		refs: 1,
+	}
+
+	start := 0
+	for i, end := range ends {
+		result.txs[i] = b[start:end]
+		start = end
+	}
+
+	return result, nil
+}
+
+// newTxsBody returns a body for serialized txs that aren't in a pooled buffer.
+func newTxsBody(b []byte) *txsBody {
+	return &txsBody{
+		b:    b,
+		refs: 1,
+	}
+}
+
+// reader returns a reader of the txs for a request body. The buffer isn't returned to the pool
+// until the reader is closed.
+func (b *txsBody) reader() io.ReadCloser {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refs++
+	return &txsBodyReader{
+		Reader: bytes.NewReader(b.b),
+		body:   b,
+	}
+}
+
+// release releases the caller's reference to the txs.
+func (b *txsBody) release() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refs--
+	if b.refs == 0 && b.buf != nil {
+		tef.PutBuffer(b.buf)
+		b.buf = nil
+		b.b = nil
+		b.txs = nil
+	}
+}
+
+func (r *txsBodyReader) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.closed {
+		r.closed = true
+		r.body.release()
+	}
+
+	return nil
+}
+
+func expandedTx(tx expanded_tx.TransactionWithOutputs) *expanded_tx.ExpandedTx {
+	switch v := tx.(type) {
+	case *expanded_tx.ExpandedTx:
+		return v
+	case expanded_tx.ExpandedTx:
+		return &v
+	default:
+		return nil
+	}
+}
+
+// encodeBody returns the body of a submit request containing the serialized txs. The result is
+// the txs body, a string, or an object to encode as JSON, which sets the content type in post.
+// When batch is true JSON bodies are an array.
+func encodeBody(body *txsBody, encoding BodyEncoding, batch bool) (interface{}, error) {
+	switch encoding {
+	case BodyEncodingBinary:
+		return body, nil
+
+	case BodyEncodingHex:
+		return hex.EncodeToString(body.b), nil
+
+	case BodyEncodingJSON:
+		if !batch {
+			return &txRequest{
+				RawTx: hex.EncodeToString(body.b),
+			}, nil
+		}
+
+		txs := body.txs
+		if txs == nil {
+			// Each tx is a separate item in a JSON body.
+			split, err := splitTxs(body.b)
+			if err != nil {
+				return nil, errors.Wrap(err, "split")
+			}
+			txs = split
+		}
+
+		requests := make([]*txRequest, len(txs))
+		for i, tx := range txs {
+			requests[i] = &txRequest{
+				RawTx: hex.EncodeToString(tx),
+			}
+		}
+		return requests, nil
+
+	default:
+		return nil, errors.Wrapf(ErrInvalidBodyEncoding, "%d", encoding)
+	}
+}
+
+// splitTxs splits concatenated serialized txs. Each tx can be raw, extended, or BEEF.
+func splitTxs(b []byte) ([][]byte, error) {
+	var result [][]byte
+	decoder := tef.NewDecoder(bytes.NewReader(b))
+	for decoder.More() {
+		start := decoder.Offset()
+
+		if beef.IsBEEF(b[start:]) {
+			etx, err := beef.Deserialize(decoder.Reader())
+			if err != nil {
+				return nil, errors.Wrapf(err, "tx %d at offset %d", decoder.Count(), start)
+			}
+			decoder.Advance(etx.TxID())
+		} else if _, err := decoder.Next(); err != nil {
+			return nil, err
+		}
+
+		result = append(result, b[start:decoder.Offset()])
+	}
+
+	if err := decoder.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (f TxFormat) String() string {
+	switch f {
+	case TxFormatDefault:
+		return "default"
+	case TxFormatExtended:
+		return "extended"
+	case TxFormatRaw:
+		return "raw"
+	case TxFormatBEEF:
+		return "beef"
+	default:
+		return ""
+	}
+}
+
+func (f *TxFormat) SetString(v string) error {
+	switch strings.ToLower(v) {
+	case "", "default":
+		*f = TxFormatDefault
+	case "extended", "ef":
+		*f = TxFormatExtended
+	case "raw":
+		*f = TxFormatRaw
+	case "beef":
+		*f = TxFormatBEEF
+	default:
+		*f = TxFormatDefault
+		return errors.Wrap(ErrInvalidTxFormat, v)
+	}
+
+	return nil
+}
+
+func (f TxFormat) MarshalText() (text []byte, err error) {
+	return []byte(f.String()), nil
+}
+
+func (f *TxFormat) UnmarshalText(text []byte) error {
+	return f.SetString(string(text))
+}
+
+func (e BodyEncoding) String() string {
+	switch e {
+	case BodyEncodingDefault:
+		return "default"
+	case BodyEncodingBinary:
+		return "binary"
+	case BodyEncodingHex:
+		return "hex"
+	case BodyEncodingJSON:
+		return "json"
+	default:
+		return ""
+	}
+}
+
+func (e *BodyEncoding) SetString(v string) error {
+	switch strings.ToLower(v) {
+	case "", "default":
+		*e = BodyEncodingDefault
+	case "binary":
+		*e = BodyEncodingBinary
+	case "hex":
+		*e = BodyEncodingHex
+	case "json":
+		*e = BodyEncodingJSON
+	default:
+		*e = BodyEncodingDefault
+		return errors.Wrap(ErrInvalidBodyEncoding, v)
+	}
+
+	return nil
+}
+
+func (e BodyEncoding) MarshalText() (text []byte, err error) {
+	return []byte(e.String()), nil
+}
+
+func (e *BodyEncoding) UnmarshalText(text []byte) error {
+	return e.SetString(string(text))
+}
@@ -0,0 +1,323 @@
+package arc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tokenized/arc/internal/txtest"
+	"github.com/tokenized/arc/pkg/beef"
+	"github.com/tokenized/arc/pkg/bump"
+	"github.com/tokenized/arc/pkg/tef"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+	"github.com/tokenized/pkg/merkle_proof"
+
+	"github.com/pkg/errors"
+)
+
+type testRequest struct {
+	contentType string
+	body        []byte
+}
+
+func Test_HTTPClient_Encodings(t *testing.T) {
+	requests := make(chan testRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- testRequest{
+			contentType: r.Header.Get("Content-Type"),
+			body:        body,
+		}
+
+		if r.URL.Path == "/"+PathSubmitTxs {
+			w.Write([]byte(`[]`))
+		} else {
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	etx := txtest.NewExpandedTx(1, 9990)
+
+	extendedBuf := &bytes.Buffer{}
+	tef.Serialize(extendedBuf, etx)
+	extendedBytes := extendedBuf.Bytes()
+
+	rawBuf := &bytes.Buffer{}
+	etx.Tx.Serialize(rawBuf)
+	rawBytes := rawBuf.Bytes()
+
+	config := DefaultConfig()
+	client := NewHTTPClient(server.URL, "", "", config)
+
+	if _, err := client.SubmitTx(ctx, etx); err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	request := <-requests
+	if request.contentType != "application/octet-stream" {
+		t.Fatalf("Wrong content type : got %s, want %s", request.contentType,
+			"application/octet-stream")
+	}
+
+	if !bytes.Equal(request.body, extendedBytes) {
+		t.Fatalf("Wrong body : \n   got %x\n  want %x", request.body, extendedBytes)
+	}
+
+	// Per client encoding.
+	config.TxFormat = TxFormatRaw
+	config.BodyEncoding = BodyEncodingHex
+	hexClient := NewHTTPClient(server.URL, "", "", config)
+
+	if _, err := hexClient.SubmitTx(ctx, etx); err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	request = <-requests
+	if request.contentType != "text/plain" {
+		t.Fatalf("Wrong content type : got %s, want %s", request.contentType, "text/plain")
+	}
+
+	if string(request.body) != hex.EncodeToString(rawBytes) {
+		t.Fatalf("Wrong body : \n   got %s\n  want %x", request.body, rawBytes)
+	}
+
+	// Per call encoding overrides the client.
+	if _, err := hexClient.SubmitTxWithOptions(ctx, etx, SubmitOptions{
+		TxFormat:     TxFormatExtended,
+		BodyEncoding: BodyEncodingJSON,
+	}); err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	request = <-requests
+	if request.contentType != "application/json" {
+		t.Fatalf("Wrong content type : got %s, want %s", request.contentType,
+			"application/json")
+	}
+
+	jsonRequest := &txRequest{}
+	if err := json.Unmarshal(request.body, jsonRequest); err != nil {
+		t.Fatalf("Failed to unmarshal body : %s", err)
+	}
+
+	if jsonRequest.RawTx != hex.EncodeToString(extendedBytes) {
+		t.Fatalf("Wrong json raw tx : \n   got %s\n  want %x", jsonRequest.RawTx, extendedBytes)
+	}
+
+	// Batches of bytes are split into separate JSON items.
+	if _, err := client.SubmitTxsBytesWithOptions(ctx, append(extendedBytes, rawBytes...),
+		SubmitOptions{BodyEncoding: BodyEncodingJSON}); err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	request = <-requests
+	var jsonRequests []*txRequest
+	if err := json.Unmarshal(request.body, &jsonRequests); err != nil {
+		t.Fatalf("Failed to unmarshal body : %s", err)
+	}
+
+	if len(jsonRequests) != 2 {
+		t.Fatalf("Wrong json request count : got %d, want %d", len(jsonRequests), 2)
+	}
+
+	if jsonRequests[1].RawTx != hex.EncodeToString(rawBytes) {
+		t.Fatalf("Wrong json raw tx : \n   got %s\n  want %x", jsonRequests[1].RawTx, rawBytes)
+	}
+}
+
+func Test_HTTPClient_EncodingFallback(t *testing.T) {
+	requests := make(chan testRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- testRequest{
+			contentType: r.Header.Get("Content-Type"),
+			body:        body,
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	config := DefaultConfig()
+	client := NewHTTPClient(server.URL, "", "", config)
+
+	// Without the parent the extended format falls back to raw.
+	etx := txtest.NewExpandedTx(1, 9990)
+	parent := etx.Ancestors[0]
+	etx.Ancestors = nil
+
+	if _, err := client.SubmitTx(ctx, etx); err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	rawBuf := &bytes.Buffer{}
+	etx.Tx.Serialize(rawBuf)
+
+	request := <-requests
+	if !bytes.Equal(request.body, rawBuf.Bytes()) {
+		t.Fatalf("Wrong raw body : \n   got %x\n  want %x", request.body, rawBuf.Bytes())
+	}
+
+	// BEEF can't be created without the parent's merkle proof, or the grand parent, so the tx
+	// falls back to extended.
+	etx.Ancestors = expanded_tx.AncestorTxs{parent}
+	options := SubmitOptions{
+		TxFormat: TxFormatBEEF,
+	}
+
+	if _, err := client.SubmitTxWithOptions(ctx, etx, options); err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	extendedBuf := &bytes.Buffer{}
+	tef.Serialize(extendedBuf, etx)
+
+	request = <-requests
+	if !bytes.Equal(request.body, extendedBuf.Bytes()) {
+		t.Fatalf("Wrong extended body : \n   got %x\n  want %x", request.body,
+			extendedBuf.Bytes())
+	}
+
+	// With the parent's merkle proof and block height the tx is BEEF.
+	txids := []bitcoin.Hash32{{}, *parent.Tx.TxHash()}
+	path, err := bump.NewMerklePath(1000, txids, 1)
+	if err != nil {
+		t.Fatalf("Failed to create merkle path : %s", err)
+	}
+
+	proof, err := path.MerkleProof(txids[1])
+	if err != nil {
+		t.Fatalf("Failed to create merkle proof : %s", err)
+	}
+
+	blockHash := bitcoin.Hash32{0x01}
+	proof.BlockHash = &blockHash
+	parent.MerkleProofs = merkle_proof.MerkleProofs{proof}
+	client.SetBlockHeights(beef.BlockHeightMap{blockHash: 1000})
+
+	if _, err := client.SubmitTxWithOptions(ctx, etx, options); err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	request = <-requests
+	if !beef.IsBEEF(request.body) {
+		t.Fatalf("Body should be BEEF : %x", request.body)
+	}
+
+	detx, err := beef.Deserialize(bytes.NewReader(request.body))
+	if err != nil {
+		t.Fatalf("Failed to deserialize BEEF : %s", err)
+	}
+
+	if detxid, txid := detx.TxID(), etx.TxID(); !detxid.Equal(&txid) {
+		t.Fatalf("Wrong BEEF txid : got %s, want %s", detxid, txid)
+	}
+
+	// The mined parent doesn't have its spent outputs so the extended format falls back to BEEF.
+	minedTx := &expanded_tx.ExpandedTx{
+		Tx:           parent.Tx,
+		MerkleProofs: parent.MerkleProofs,
+	}
+
+	if _, err := client.SubmitTx(ctx, minedTx); err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	request = <-requests
+	if !beef.IsBEEF(request.body) {
+		t.Fatalf("Body should be BEEF : %x", request.body)
+	}
+
+	// Errors that aren't caused by missing data are returned instead of falling back.
+	options.BlockHeights = testFailingHeights{}
+	if _, err := client.SubmitTxWithOptions(ctx, etx, options); !errors.Is(err,
+		errTestHeights) {
+		t.Fatalf("Wrong heights error : got %v, want %s", err, errTestHeights)
+	}
+}
+
+var errTestHeights = errors.New("Test Heights")
+
+type testFailingHeights struct{}
+
+func (testFailingHeights) BlockHeight(blockHash bitcoin.Hash32) (uint64, error) {
+	return 0, errTestHeights
+}
+
+func Benchmark_HTTPClient_EncodeTxs(b *testing.B) {
+	config := DefaultConfig()
+	client := NewHTTPClient("http://localhost", "", "", config)
+
+	txs := make([]expanded_tx.TransactionWithOutputs, 100)
+	for i := range txs {
+		txs[i] = txtest.NewExpandedTx(1, 9990)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		body, err := client.encodeTxs(txs, SubmitOptions{})
+		if err != nil {
+			b.Fatalf("Failed to encode txs : %s", err)
+		}
+
+		if _, err := encodeBody(body, BodyEncodingBinary, true); err != nil {
+			b.Fatalf("Failed to encode body : %s", err)
+		}
+		body.release()
+	}
+}
+
+func Test_TxsBody_Release(t *testing.T) {
+	config := DefaultConfig()
+	client := NewHTTPClient("http://localhost", "", "", config)
+
+	body, err := client.encodeTxs([]expanded_tx.TransactionWithOutputs{txtest.NewExpandedTx(1, 9990),
+		txtest.NewExpandedTx(1, 9990)}, SubmitOptions{})
+	if err != nil {
+		t.Fatalf("Failed to encode txs : %s", err)
+	}
+
+	if len(body.txs) != 2 {
+		t.Fatalf("Wrong tx count : got %d, want %d", len(body.txs), 2)
+	}
+
+	want := make([]byte, len(body.b))
+	copy(want, body.b)
+
+	// The transport can still be reading the request body after the submit returns.
+	reader := body.reader()
+	body.release()
+
+	if body.buf == nil {
+		t.Fatalf("Buffer should not be returned to the pool before the reader is closed")
+	}
+
+	got, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to read body : %s", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Wrong body : \n   got %x\n  want %x", got, want)
+	}
+
+	reader.Close()
+	reader.Close()
+
+	if body.buf != nil {
+		t.Fatalf("Buffer should be returned to the pool after the reader is closed")
+	}
+
+	if body.refs != 0 {
+		t.Fatalf("Wrong reference count : got %d, want %d", body.refs, 0)
+	}
+}
@@ -0,0 +1,218 @@
+package arc
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ErrorClassUnknown is an error that can't be classified.
+	ErrorClassUnknown = ErrorClass(0)
+
+	// ErrorClassTxInvalid is a deterministic rejection of the tx. Submitting it again will always
+	// fail.
+	ErrorClassTxInvalid = ErrorClass(1)
+
+	// ErrorClassRetryable is a temporary failure of the endpoint or network. The same request can
+	// safely be sent again.
+	ErrorClassRetryable = ErrorClass(2)
+
+	// ErrorClassAuth is a missing or invalid auth token.
+	ErrorClassAuth = ErrorClass(3)
+
+	// ErrorClassClientBug is a request that ARC can't process because it is malformed or is missing
+	// data, like spent outputs or ancestor merkle proofs.
+	ErrorClassClientBug = ErrorClass(4)
+
+	// ErrorClassNotFound is a request for a tx or resource that the endpoint doesn't have. A tx
+	// status request returns it when ARC hasn't seen the tx.
+	ErrorClassNotFound = ErrorClass(5)
+)
+
+type ErrorClass uint8
+
+// EndpointError is the error returned by one endpoint of a client that sends requests to several
+// endpoints.
+type EndpointError struct {
+	URL string
+	Err error
+}
+
+// EndpointErrors is returned when a request fails on every endpoint. errors.Is and errors.As match
+// the error from any endpoint and the cause is the error from the first endpoint so ClassifyError
+// still classifies it.
+type EndpointErrors []EndpointError
+
+var (
+	httpStatusClasses = map[int]ErrorClass{
+		http.StatusBadRequest:          ErrorClassClientBug,
+		http.StatusUnauthorized:        ErrorClassAuth,
+		http.StatusForbidden:           ErrorClassAuth,
+		http.StatusNotFound:            ErrorClassNotFound,
+		http.StatusConflict:            ErrorClassClientBug,
+		http.StatusUnprocessableEntity: ErrorClassClientBug,
+		http.StatusTooManyRequests:     ErrorClassRetryable,
+		http.StatusInternalServerError: ErrorClassRetryable,
+		http.StatusBadGateway:          ErrorClassRetryable,
+		http.StatusServiceUnavailable:  ErrorClassRetryable,
+		http.StatusGatewayTimeout:      ErrorClassRetryable,
+		460:                            ErrorClassClientBug,
+		461:                            ErrorClassTxInvalid,
+		462:                            ErrorClassTxInvalid,
+		463:                            ErrorClassTxInvalid,
+		464:                            ErrorClassTxInvalid,
+		465:                            ErrorClassTxInvalid,
+		466:                            ErrorClassTxInvalid,
+		467:                            ErrorClassClientBug,
+		468:                            ErrorClassClientBug,
+		469:                            ErrorClassClientBug,
+		471:                            ErrorClassTxInvalid,
+		472:                            ErrorClassTxInvalid,
+		473:                            ErrorClassTxInvalid,
+		474:                            ErrorClassTxInvalid,
+		475:                            ErrorClassClientBug,
+		476:                            ErrorClassClientBug,
+	}
+)
+
+// ClassifyError returns the class of an error returned by a client so callers and retry logic can
+// decide how to handle it.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassUnknown
+	}
+
+	if errors.Is(err, ErrTimeout) {
+		return ErrorClassRetryable
+	}
+
+	if errors.Cause(err) == ErrCanceled {
+		return ErrorClassUnknown
+	}
+
+	var httpError HTTPError
+	if errors.As(err, &httpError) {
+		if class, exists := httpStatusClasses[httpError.Status]; exists {
+			return class
+		}
+
+		return ErrorClassUnknown
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) {
+		return ErrorClassRetryable
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return ErrorClassRetryable
+	}
+
+	return ErrorClassUnknown
+}
+
+// Returns true if this error represents an error caused by a tx being invalid.
+func IsInvalidTxError(err error) bool {
+	return ClassifyError(err) == ErrorClassTxInvalid
+}
+
+// IsRetryableError returns true if the request that returned the error can safely be attempted
+// again. Submitting the same tx again is safe because ARC responds with the current status of txs
+// it has already seen.
+func IsRetryableError(err error) bool {
+	return ClassifyError(err) == ErrorClassRetryable
+}
+
+// IsAuthError returns true if the error was caused by a missing or invalid auth token.
+func IsAuthError(err error) bool {
+	return ClassifyError(err) == ErrorClassAuth
+}
+
+// IsClientBugError returns true if the error was caused by a malformed or incomplete request.
+func IsClientBugError(err error) bool {
+	return ClassifyError(err) == ErrorClassClientBug
+}
+
+// IsNotFoundError returns true if the endpoint doesn't have the requested tx or resource.
+func IsNotFoundError(err error) bool {
+	return ClassifyError(err) == ErrorClassNotFound
+}
+
+func (err EndpointError) Error() string {
+	return fmt.Sprintf("%s: %s", err.URL, err.Err)
+}
+
+func (err EndpointError) Cause() error {
+	return err.Err
+}
+
+func (err EndpointError) Unwrap() error {
+	return err.Err
+}
+
+func (errs EndpointErrors) Error() string {
+	result := make([]string, len(errs))
+	for i, err := range errs {
+		result[i] = err.Error()
+	}
+
+	return strings.Join(result, ", ")
+}
+
+// Cause returns the error from the first endpoint.
+func (errs EndpointErrors) Cause() error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs[0].Err
+}
+
+// Is returns true if the error from any endpoint matches the target.
+func (errs EndpointErrors) Is(target error) bool {
+	for _, err := range errs {
+		if errors.Is(err.Err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error from an endpoint that matches the target.
+func (errs EndpointErrors) As(target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err.Err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassUnknown:
+		return "unknown"
+	case ErrorClassTxInvalid:
+		return "tx_invalid"
+	case ErrorClassRetryable:
+		return "retryable"
+	case ErrorClassAuth:
+		return "auth"
+	case ErrorClassClientBug:
+		return "client_bug"
+	case ErrorClassNotFound:
+		return "not_found"
+	default:
+		return ""
+	}
+}
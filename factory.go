@@ -9,14 +9,41 @@ import (
 )
 
 type Config struct {
-	ConnectTimeout config.Duration `defautl:"10s" json:"connection_timeout"`
-	RequestTimeout config.Duration `defautl:"30s" json:"request_timeout"`
+	ConnectTimeout config.Duration `default:"10s" json:"connection_timeout"`
+	RequestTimeout config.Duration `default:"30s" json:"request_timeout"`
+
+	// MaxAttempts is the maximum number of times a request is attempted when it fails with a
+	// retryable error. Zero or one means requests are not retried, which is the default so retries
+	// are opt in.
+	MaxAttempts int `default:"1" json:"max_attempts"`
+
+	// BaseBackoff is the delay before the first retry. It doubles with each following retry until
+	// it reaches MaxBackoff. A Retry-After from the server replaces the backoff, but the request
+	// isn't retried when it is longer than MaxBackoff.
+	BaseBackoff config.Duration `default:"500ms" json:"base_backoff"`
+	MaxBackoff  config.Duration `default:"10s" json:"max_backoff"`
+
+	// Jitter is the fraction, from 0 to 1, of each backoff that is randomized so that clients
+	// don't retry in lock step.
+	Jitter float64 `default:"0.2" json:"jitter"`
+
+	// TxFormat is the format txs are submitted in. Default is the extended format.
+	TxFormat TxFormat `json:"tx_format"`
+
+	// BodyEncoding is how txs are encoded in submit requests. Default is binary.
+	BodyEncoding BodyEncoding `json:"body_encoding"`
 }
 
 func (c Config) Copy() Config {
 	return Config{
 		ConnectTimeout: c.ConnectTimeout,
 		RequestTimeout: c.RequestTimeout,
+		MaxAttempts:    c.MaxAttempts,
+		BaseBackoff:    c.BaseBackoff,
+		MaxBackoff:     c.MaxBackoff,
+		Jitter:         c.Jitter,
+		TxFormat:       c.TxFormat,
+		BodyEncoding:   c.BodyEncoding,
 	}
 }
 
@@ -24,6 +51,10 @@ func DefaultConfig() Config {
 	return Config{
 		ConnectTimeout: config.NewDuration(time.Second * 10),
 		RequestTimeout: config.NewDuration(time.Second * 30),
+		MaxAttempts:    1,
+		BaseBackoff:    config.NewDuration(time.Millisecond * 500),
+		MaxBackoff:     config.NewDuration(time.Second * 10),
+		Jitter:         0.2,
 	}
 }
 
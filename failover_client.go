@@ -0,0 +1,386 @@
+package arc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tokenized/config"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+)
+
+type FailoverConfig struct {
+	// MinHealthScore is the health score below which an endpoint is failed over.
+	MinHealthScore float64 `default:"0.6" json:"min_health_score"`
+
+	// HealthWindow is the number of recent requests used to calculate the health score of each
+	// endpoint.
+	HealthWindow int             `default:"20" json:"health_window"`
+	SlowLatency  config.Duration `default:"5s" json:"slow_latency"`
+
+	// MinHealthSamples is the number of requests that must be recorded for an endpoint before it
+	// can be failed over so a single failure doesn't fail over an endpoint that was just started.
+	MinHealthSamples int `default:"5" json:"min_health_samples"`
+
+	// HealthCheckInterval is the time between policy requests sent to failed endpoints.
+	HealthCheckInterval config.Duration `default:"30s" json:"health_check_interval"`
+
+	// RecoveryChecks is the number of consecutive successful health checks required before a failed
+	// endpoint is reinstated.
+	RecoveryChecks int `default:"3" json:"recovery_checks"`
+}
+
+func DefaultFailoverConfig() FailoverConfig {
+	return FailoverConfig{
+		MinHealthScore:      0.6,
+		HealthWindow:        DefaultHealthWindow,
+		SlowLatency:         config.NewDuration(DefaultSlowLatency),
+		MinHealthSamples:    5,
+		HealthCheckInterval: config.NewDuration(time.Second * 30),
+		RecoveryChecks:      3,
+	}
+}
+
+// FailoverClient is a Client that sends all requests to the first healthy endpoint in its list.
+// When an endpoint's health score drops below the minimum it is marked as failed and requests go to
+// the next healthy endpoint. Run must be running for failed endpoints to be checked and reinstated.
+type FailoverClient struct {
+	endpoints []*failoverEndpoint
+	config    FailoverConfig
+
+	lock sync.Mutex
+}
+
+type failoverEndpoint struct {
+	client Client
+	health *EndpointHealth
+
+	failed         bool
+	recoveryChecks int
+}
+
+func NewFailoverClient(clients []Client, config FailoverConfig) *FailoverClient {
+	result := &FailoverClient{
+		config: config,
+	}
+
+	for _, client := range clients {
+		result.endpoints = append(result.endpoints, &failoverEndpoint{
+			client: client,
+			health: NewEndpointHealth(config.HealthWindow, config.SlowLatency.Duration),
+		})
+	}
+
+	return result
+}
+
+// URL returns the url of the endpoint currently in use.
+func (c *FailoverClient) URL() string {
+	endpoint := c.active()
+	if endpoint == nil {
+		return ""
+	}
+
+	return endpoint.client.URL()
+}
+
+func (c *FailoverClient) GetPolicy(ctx context.Context) (*Policy, error) {
+	var result *Policy
+	err := c.do(ctx, func(client Client) error {
+		policy, err := client.GetPolicy(ctx)
+		result = policy
+		return err
+	})
+
+	return result, err
+}
+
+func (c *FailoverClient) GetTxStatus(ctx context.Context,
+	txid bitcoin.Hash32) (*TxStatusResponse, error) {
+
+	var result *TxStatusResponse
+	err := c.do(ctx, func(client Client) error {
+		response, err := client.GetTxStatus(ctx, txid)
+		result = response
+		return err
+	})
+
+	return result, err
+}
+
+func (c *FailoverClient) SubmitTx(ctx context.Context,
+	tx expanded_tx.TransactionWithOutputs) (*TxSubmitResponse, error) {
+
+	var result *TxSubmitResponse
+	err := c.do(ctx, func(client Client) error {
+		response, err := client.SubmitTx(ctx, tx)
+		result = response
+		return err
+	})
+
+	return result, err
+}
+
+func (c *FailoverClient) SubmitTxBytes(ctx context.Context,
+	txBytes []byte) (*TxSubmitResponse, error) {
+
+	var result *TxSubmitResponse
+	err := c.do(ctx, func(client Client) error {
+		response, err := client.SubmitTxBytes(ctx, txBytes)
+		result = response
+		return err
+	})
+
+	return result, err
+}
+
+func (c *FailoverClient) SubmitTxs(ctx context.Context,
+	txs []expanded_tx.TransactionWithOutputs) ([]*TxSubmitResponse, error) {
+
+	var result []*TxSubmitResponse
+	err := c.do(ctx, func(client Client) error {
+		responses, err := client.SubmitTxs(ctx, txs)
+		result = responses
+		return err
+	})
+
+	return result, err
+}
+
+func (c *FailoverClient) SubmitTxsBytes(ctx context.Context,
+	txsBytes []byte) ([]*TxSubmitResponse, error) {
+
+	var result []*TxSubmitResponse
+	err := c.do(ctx, func(client Client) error {
+		responses, err := client.SubmitTxsBytes(ctx, txsBytes)
+		result = responses
+		return err
+	})
+
+	return result, err
+}
+
+func (c *FailoverClient) SubmitTxWithOptions(ctx context.Context,
+	tx expanded_tx.TransactionWithOutputs, options SubmitOptions) (*TxSubmitResponse, error) {
+
+	var result *TxSubmitResponse
+	err := c.do(ctx, func(client Client) error {
+		optionsClient, err := asOptionsClient(client)
+		if err != nil {
+			return err
+		}
+
+		response, err := optionsClient.SubmitTxWithOptions(ctx, tx, options)
+		result = response
+		return err
+	})
+
+	return result, err
+}
+
+func (c *FailoverClient) SubmitTxBytesWithOptions(ctx context.Context, txBytes []byte,
+	options SubmitOptions) (*TxSubmitResponse, error) {
+
+	var result *TxSubmitResponse
+	err := c.do(ctx, func(client Client) error {
+		optionsClient, err := asOptionsClient(client)
+		if err != nil {
+			return err
+		}
+
+		response, err := optionsClient.SubmitTxBytesWithOptions(ctx, txBytes, options)
+		result = response
+		return err
+	})
+
+	return result, err
+}
+
+func (c *FailoverClient) SubmitTxsWithOptions(ctx context.Context,
+	txs []expanded_tx.TransactionWithOutputs,
+	options SubmitOptions) ([]*TxSubmitResponse, error) {
+
+	var result []*TxSubmitResponse
+	err := c.do(ctx, func(client Client) error {
+		optionsClient, err := asOptionsClient(client)
+		if err != nil {
+			return err
+		}
+
+		responses, err := optionsClient.SubmitTxsWithOptions(ctx, txs, options)
+		result = responses
+		return err
+	})
+
+	return result, err
+}
+
+func (c *FailoverClient) SubmitTxsBytesWithOptions(ctx context.Context, txsBytes []byte,
+	options SubmitOptions) ([]*TxSubmitResponse, error) {
+
+	var result []*TxSubmitResponse
+	err := c.do(ctx, func(client Client) error {
+		optionsClient, err := asOptionsClient(client)
+		if err != nil {
+			return err
+		}
+
+		responses, err := optionsClient.SubmitTxsBytesWithOptions(ctx, txsBytes, options)
+		result = responses
+		return err
+	})
+
+	return result, err
+}
+
+// Run checks failed endpoints with policy requests and reinstates them when they respond
+// successfully enough times in a row.
+func (c *FailoverClient) Run(ctx context.Context, interrupt <-chan interface{}) error {
+	interval := c.config.HealthCheckInterval.Duration
+	if interval <= 0 {
+		interval = DefaultFailoverConfig().HealthCheckInterval.Duration
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.checkFailed(ctx)
+		case <-interrupt:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Status returns the url, health score, and failed state of each endpoint.
+func (c *FailoverClient) Status() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var result []string
+	for _, endpoint := range c.endpoints {
+		status := "ok"
+		if endpoint.failed {
+			status = "failed"
+		}
+
+		result = append(result, fmt.Sprintf("%s: %.2f %s", endpoint.client.URL(),
+			endpoint.health.Score(), status))
+	}
+
+	return strings.Join(result, ", ")
+}
+
+// do calls the function with each healthy endpoint in order until one succeeds or returns an error
+// that isn't caused by the endpoint.
+func (c *FailoverClient) do(ctx context.Context, f func(Client) error) error {
+	tried := make(map[*failoverEndpoint]bool)
+	var errs EndpointErrors
+	for {
+		endpoint := c.nextEndpoint(tried)
+		if endpoint == nil {
+			break
+		}
+		tried[endpoint] = true
+
+		start := time.Now()
+		err := f(endpoint.client)
+		endpoint.health.Record(time.Since(start), err)
+		c.updateHealth(endpoint)
+
+		if err == nil {
+			return nil
+		}
+
+		if !IsRetryableError(err) {
+			return err
+		}
+
+		errs = append(errs, EndpointError{URL: endpoint.client.URL(), Err: err})
+	}
+
+	if len(errs) == 0 {
+		return ErrNoClients
+	}
+
+	return errs
+}
+
+// active returns the first endpoint that isn't failed.
+func (c *FailoverClient) active() *failoverEndpoint {
+	return c.nextEndpoint(nil)
+}
+
+// nextEndpoint returns the first endpoint that isn't failed or already tried. Once all healthy
+// endpoints have been tried the failed endpoints are returned as a last resort.
+func (c *FailoverClient) nextEndpoint(tried map[*failoverEndpoint]bool) *failoverEndpoint {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, endpoint := range c.endpoints {
+		if !endpoint.failed && !tried[endpoint] {
+			return endpoint
+		}
+	}
+
+	for _, endpoint := range c.endpoints {
+		if !tried[endpoint] {
+			return endpoint
+		}
+	}
+
+	return nil
+}
+
+func (c *FailoverClient) updateHealth(endpoint *failoverEndpoint) {
+	if endpoint.health.Count() < c.config.MinHealthSamples {
+		return
+	}
+
+	score := endpoint.health.Score()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !endpoint.failed && score < c.config.MinHealthScore {
+		endpoint.failed = true
+		endpoint.recoveryChecks = 0
+	}
+}
+
+func (c *FailoverClient) checkFailed(ctx context.Context) {
+	c.lock.Lock()
+	var failed []*failoverEndpoint
+	for _, endpoint := range c.endpoints {
+		if endpoint.failed {
+			failed = append(failed, endpoint)
+		}
+	}
+	c.lock.Unlock()
+
+	for _, endpoint := range failed {
+		start := time.Now()
+		_, err := endpoint.client.GetPolicy(ctx)
+		endpoint.health.Record(time.Since(start), err)
+
+		c.lock.Lock()
+		if err != nil {
+			endpoint.recoveryChecks = 0
+		} else {
+			endpoint.recoveryChecks++
+			if endpoint.recoveryChecks >= c.config.RecoveryChecks {
+				endpoint.health.Reset()
+				endpoint.failed = false
+				endpoint.recoveryChecks = 0
+			}
+		}
+		c.lock.Unlock()
+	}
+}
@@ -0,0 +1,118 @@
+package arc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func Test_FailoverClient(t *testing.T) {
+	var primaryHealthy int32
+	var primaryCount int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryCount, 1)
+		if atomic.LoadInt32(&primaryHealthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte(`{}`))
+	}))
+	defer primary.Close()
+
+	secondary := newTestSubmitServer(http.StatusOK, `{"txStatus":"SEEN_ON_NETWORK"}`)
+	defer secondary.Close()
+
+	cfg := testRetryConfig()
+	cfg.MaxAttempts = 1
+	failoverConfig := DefaultFailoverConfig()
+	client := NewFailoverClient([]Client{
+		NewHTTPClient(primary.URL, "", "", cfg),
+		NewHTTPClient(secondary.URL, "", "", cfg),
+	}, failoverConfig)
+
+	ctx := context.Background()
+	for i := 0; i < failoverConfig.MinHealthSamples; i++ {
+		if client.URL() != primary.URL {
+			t.Fatalf("Failed over after %d requests, want %d", i,
+				failoverConfig.MinHealthSamples)
+		}
+
+		if _, err := client.SubmitTxBytes(ctx, []byte{0x01}); err != nil {
+			t.Fatalf("Failed to submit : %s", err)
+		}
+	}
+
+	if client.URL() != secondary.URL {
+		t.Fatalf("Wrong active url : got %s, want %s", client.URL(), secondary.URL)
+	}
+
+	if _, err := client.SubmitTxBytes(ctx, []byte{0x01}); err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	wantCount := int32(failoverConfig.MinHealthSamples)
+	if count := atomic.LoadInt32(&primaryCount); count != wantCount {
+		t.Fatalf("Wrong primary request count : got %d, want %d", count, wantCount)
+	}
+
+	t.Logf("Status : %s", client.Status())
+
+	atomic.StoreInt32(&primaryHealthy, 1)
+	for i := 0; i < DefaultFailoverConfig().RecoveryChecks; i++ {
+		client.checkFailed(ctx)
+	}
+
+	t.Logf("Status : %s", client.Status())
+
+	if client.URL() != primary.URL {
+		t.Fatalf("Wrong active url after recovery : got %s, want %s", client.URL(), primary.URL)
+	}
+}
+
+func Test_FailoverClient_Errors(t *testing.T) {
+	primary := newTestSubmitServer(http.StatusServiceUnavailable, "")
+	defer primary.Close()
+	secondary := newTestSubmitServer(http.StatusGatewayTimeout, "")
+	defer secondary.Close()
+
+	cfg := testRetryConfig()
+	cfg.MaxAttempts = 1
+	failoverConfig := DefaultFailoverConfig()
+	failoverConfig.HealthWindow = 2
+	failoverConfig.MinHealthSamples = 2
+	client := NewFailoverClient([]Client{
+		NewHTTPClient(primary.URL, "", "", cfg),
+		NewHTTPClient(secondary.URL, "", "", cfg),
+	}, failoverConfig)
+
+	_, err := client.SubmitTxBytes(context.Background(), []byte{0x01})
+	if err == nil {
+		t.Fatalf("Submit should fail")
+	}
+	t.Logf("Error : %s", err)
+
+	if !IsRetryableError(err) {
+		t.Errorf("Wrong error class : got %s, want %s", ClassifyError(err),
+			ErrorClassRetryable)
+	}
+
+	var httpError HTTPError
+	if !errors.As(err, &httpError) || httpError.Status != http.StatusServiceUnavailable {
+		t.Errorf("Error should contain the primary HTTPError")
+	}
+
+	if client.endpoints[0].failed {
+		t.Fatalf("Failed over before the min health samples")
+	}
+
+	client.SubmitTxBytes(context.Background(), []byte{0x01})
+
+	if !client.endpoints[0].failed {
+		t.Fatalf("Primary should be failed over after the min health samples")
+	}
+}
@@ -0,0 +1,134 @@
+package arc
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultHealthWindow is the number of recent requests used to calculate a health score.
+	DefaultHealthWindow = 20
+
+	// DefaultSlowLatency is the average latency above which an endpoint's health score is reduced.
+	DefaultSlowLatency = time.Second * 5
+)
+
+// EndpointHealth is a rolling health score of an endpoint built from the latency, server error rate
+// and timeout rate of its most recent requests.
+type EndpointHealth struct {
+	samples     []healthSample
+	next        int
+	count       int
+	slowLatency time.Duration
+
+	lock sync.Mutex
+}
+
+type healthSample struct {
+	latency     time.Duration
+	serverError bool
+	timeout     bool
+}
+
+func NewEndpointHealth(window int, slowLatency time.Duration) *EndpointHealth {
+	if window < 1 {
+		window = DefaultHealthWindow
+	}
+
+	return &EndpointHealth{
+		samples:     make([]healthSample, window),
+		slowLatency: slowLatency,
+	}
+}
+
+// Record adds the result of a request to the health score. Errors caused by the request, like an
+// invalid tx, don't reduce the score because the endpoint is working properly.
+func (h *EndpointHealth) Record(latency time.Duration, err error) {
+	sample := healthSample{
+		latency: latency,
+	}
+
+	if err != nil {
+		var httpError HTTPError
+		switch {
+		case errors.Cause(err) == ErrCanceled:
+			return // not the endpoint's fault
+		case errors.Is(err, ErrTimeout):
+			sample.timeout = true
+		case errors.As(err, &httpError):
+			sample.serverError = httpError.Status >= http.StatusInternalServerError
+		default:
+			sample.serverError = IsRetryableError(err) // transport errors
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.samples[h.next] = sample
+	h.next = (h.next + 1) % len(h.samples)
+	if h.count < len(h.samples) {
+		h.count++
+	}
+}
+
+// Score returns a value from 0 to 1 where 1 is completely healthy. The rate of server errors and
+// timeouts is subtracted from 1 and up to a further 0.25 is subtracted when the average latency is
+// above the slow latency. An endpoint without any recorded requests has a score of 1.
+func (h *EndpointHealth) Score() float64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.count == 0 {
+		return 1.0
+	}
+
+	failures := 0
+	var totalLatency time.Duration
+	for i := 0; i < h.count; i++ {
+		sample := h.samples[i]
+		if sample.serverError || sample.timeout {
+			failures++
+		}
+		totalLatency += sample.latency
+	}
+
+	score := 1.0 - float64(failures)/float64(h.count)
+
+	if h.slowLatency > 0 {
+		averageLatency := totalLatency / time.Duration(h.count)
+		if averageLatency > h.slowLatency {
+			penalty := 0.25 * float64(averageLatency-h.slowLatency) / float64(h.slowLatency)
+			if penalty > 0.25 {
+				penalty = 0.25
+			}
+			score -= penalty
+		}
+	}
+
+	if score < 0.0 {
+		return 0.0
+	}
+
+	return score
+}
+
+// Count returns the number of requests in the window.
+func (h *EndpointHealth) Count() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.count
+}
+
+// Reset clears all recorded requests.
+func (h *EndpointHealth) Reset() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.next = 0
+	h.count = 0
+}
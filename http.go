@@ -10,8 +10,9 @@ import (
 	"net"
 	"net/http"
 	"sync/atomic"
+	"time"
 
-	"github.com/tokenized/arc/pkg/tef"
+	"github.com/tokenized/arc/pkg/beef"
 	"github.com/tokenized/pkg/bitcoin"
 	"github.com/tokenized/pkg/expanded_tx"
 	"github.com/tokenized/pkg/peer_channels"
@@ -29,20 +30,87 @@ const (
 	HeaderKeyCallbackToken     = "X-CallbackToken"
 	HeaderKeyFullStatusUpdates = "X-FullStatusUpdates"
 	HeaderKeyWaitForStatus     = "X-WaitForStatus"
+	HeaderKeyMaxTimeout        = "X-MaxTimeout"
+
+	HeaderKeySkipFeeValidation       = "X-SkipFeeValidation"
+	HeaderKeySkipScriptValidation    = "X-SkipScriptValidation"
+	HeaderKeySkipTxValidation        = "X-SkipTxValidation"
+	HeaderKeyCumulativeFeeValidation = "X-CumulativeFeeValidation"
+	HeaderKeyCallbackBatch           = "X-CallbackBatch"
 )
 
 var (
+	ErrUnauthorized           = errors.New("Unauthorized")
+	ErrNotFound               = errors.New("Not Found")
+	ErrNotExtendedFormat      = errors.New("Not Extended Format")
+	ErrMalformedTx            = errors.New("Malformed Transaction")
+	ErrInvalidInputs          = errors.New("Invalid Inputs")
+	ErrInvalidOutputs         = errors.New("Invalid Outputs")
+	ErrFeeTooLow              = errors.New("Fee Too Low")
+	ErrConflictingTx          = errors.New("Conflicting Transaction")
+	ErrMinedAncestorsNotFound = errors.New("Mined Ancestors Not Found")
+	ErrInvalidBUMPs           = errors.New("Invalid BUMPs")
+	ErrInvalidMerkleRoots     = errors.New("Invalid Merkle Roots")
+	ErrFrozenByPolicy         = errors.New("Input Frozen By Policy")
+	ErrFrozenByConsensus      = errors.New("Input Frozen By Consensus")
+	ErrCumulativeFeeTooLow    = errors.New("Cumulative Fee Too Low")
+	ErrTxTooLarge             = errors.New("Transaction Too Large")
+	ErrInvalidBEEF            = errors.New("Invalid BEEF")
+	ErrUnconfirmedInputs      = errors.New("Unconfirmed Inputs")
+
+	// httpStatusErrors are the errors that match HTTP errors with errors.Is.
+	httpStatusErrors = map[int]error{
+		http.StatusUnauthorized: ErrUnauthorized,
+		http.StatusNotFound:     ErrNotFound,
+		460:                     ErrNotExtendedFormat,
+		461:                     ErrMalformedTx,
+		462:                     ErrInvalidInputs,
+		463:                     ErrMalformedTx,
+		464:                     ErrInvalidOutputs,
+		465:                     ErrFeeTooLow,
+		466:                     ErrConflictingTx,
+		467:                     ErrMinedAncestorsNotFound,
+		468:                     ErrInvalidBUMPs,
+		469:                     ErrInvalidMerkleRoots,
+		471:                     ErrFrozenByPolicy,
+		472:                     ErrFrozenByConsensus,
+		473:                     ErrCumulativeFeeTooLow,
+		474:                     ErrTxTooLarge,
+		475:                     ErrInvalidBEEF,
+		476:                     ErrUnconfirmedInputs,
+
+		// A gateway timeout is an HTTPError that also matches ErrTimeout.
+		http.StatusGatewayTimeout: ErrTimeout,
+	}
+
 	httpStatusDescriptions = map[int]string{
 		http.StatusBadRequest:          "bad request",
 		http.StatusUnauthorized:        "unauthorized",
+		http.StatusForbidden:           "forbidden",
+		http.StatusNotFound:            "not found",
 		http.StatusConflict:            "generic",
 		http.StatusUnprocessableEntity: "malformed request",
+		http.StatusTooManyRequests:     "too many requests",
+		http.StatusInternalServerError: "internal server error",
+		http.StatusBadGateway:          "bad gateway",
+		http.StatusServiceUnavailable:  "service unavailable",
+		http.StatusGatewayTimeout:      "gateway timeout",
 		460:                            "not extended format",
 		461:                            "malformed transaction",
 		462:                            "invalid inputs",
 		463:                            "malformed transaction",
 		464:                            "invalid outputs",
 		465:                            "fee too low",
+		466:                            "conflicting transaction found",
+		467:                            "mined ancestors not found",
+		468:                            "invalid BUMPs",
+		469:                            "merkle roots validation failed",
+		471:                            "input frozen by policy",
+		472:                            "input frozen by consensus",
+		473:                            "cumulative fee validation failed",
+		474:                            "transaction too large",
+		475:                            "invalid BEEF",
+		476:                            "unconfirmed inputs",
 	}
 )
 
@@ -50,7 +118,9 @@ type HTTPClient struct {
 	url         atomic.Value
 	authToken   atomic.Value
 	callBackURL atomic.Value
+	heights     atomic.Value // blockHeights
 
+	config     Config
 	httpClient *http.Client
 }
 
@@ -58,6 +128,13 @@ type HTTPError struct {
 	Status      int
 	Message     string
 	Description string
+
+	// Data is the RFC7807 problem document returned by ARC. It is nil when the response body isn't
+	// a problem document.
+	Data *ErrorData
+
+	// RetryAfter is the delay requested by the Retry-After header of a 429 or 503 response.
+	RetryAfter time.Duration
 }
 
 func (err HTTPError) Error() string {
@@ -74,19 +151,62 @@ func (err HTTPError) Error() string {
 	return result
 }
 
-// Returns true if this error represents an error caused by a tx being invalid.
-func IsInvalidTxError(err error) bool {
-	httpError, ok := err.(HTTPError)
-	if !ok {
-		return false
+// Is makes errors.Is match the sentinel error for the HTTP status, for example ErrFeeTooLow.
+func (err HTTPError) Is(target error) bool {
+	if statusErr, exists := httpStatusErrors[err.Status]; exists {
+		return statusErr == target
 	}
 
-	switch httpError.Status {
-	case 461, 462, 463, 464, 465:
-		return true
-	default:
-		return false
+	return false
+}
+
+// TxID returns the txid in the problem document.
+func (err HTTPError) TxID() *bitcoin.Hash32 {
+	if err.Data == nil {
+		return nil
 	}
+
+	return err.Data.TxID
+}
+
+// ExtraInfo returns the extra info in the problem document.
+func (err HTTPError) ExtraInfo() string {
+	if err.Data == nil || err.Data.ExtraInfo == nil {
+		return ""
+	}
+
+	return *err.Data.ExtraInfo
+}
+
+// newHTTPError creates an error from an unsuccessful response. The body is decoded into ErrorData
+// when it is a problem document, otherwise it is used as the message.
+func newHTTPError(httpResponse *http.Response) HTTPError {
+	result := HTTPError{Status: httpResponse.StatusCode}
+
+	if httpResponse.Body != nil {
+		b, rerr := ioutil.ReadAll(httpResponse.Body)
+		if rerr == nil {
+			data := &ErrorData{}
+			if err := json.Unmarshal(b, data); err == nil && (data.Status != 0 ||
+				len(data.Title) > 0 || len(data.Detail) > 0) {
+				result.Data = data
+				result.Message = data.Description()
+			} else {
+				result.Message = string(b)
+			}
+		}
+	}
+
+	if description, exists := httpStatusDescriptions[httpResponse.StatusCode]; exists {
+		result.Description = description
+	}
+
+	switch httpResponse.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		result.RetryAfter = parseRetryAfter(httpResponse.Header.Get("Retry-After"))
+	}
+
+	return result
 }
 
 func NewHTTPClient(url, authToken, callBackURL string, config Config) *HTTPClient {
@@ -98,6 +218,7 @@ func NewHTTPClient(url, authToken, callBackURL string, config Config) *HTTPClien
 	}
 
 	result := &HTTPClient{
+		config: config,
 		httpClient: &http.Client{
 			Timeout:   config.RequestTimeout.Duration,
 			Transport: transport,
@@ -127,7 +248,7 @@ func (c HTTPClient) GetPolicy(ctx context.Context) (*Policy, error) {
 	}
 
 	policy := &Policy{}
-	if err := c.get(path, header, policy); err != nil {
+	if err := c.get(ctx, path, header, policy); err != nil {
 		return nil, errors.Wrap(err, "get")
 	}
 
@@ -144,7 +265,7 @@ func (c HTTPClient) GetTxStatus(ctx context.Context,
 	}
 
 	response := &TxStatusResponse{}
-	if err := c.get(path, header, response); err != nil {
+	if err := c.get(ctx, path, header, response); err != nil {
 		return nil, errors.Wrap(err, "get")
 	}
 
@@ -154,89 +275,254 @@ func (c HTTPClient) GetTxStatus(ctx context.Context,
 func (c HTTPClient) SubmitTx(ctx context.Context,
 	tx expanded_tx.TransactionWithOutputs) (*TxSubmitResponse, error) {
 
-	buf := &bytes.Buffer{}
-	if err := tef.Serialize(buf, tx); err != nil {
+	return c.SubmitTxWithOptions(ctx, tx, c.defaultSubmitOptions())
+}
+
+func (c HTTPClient) SubmitTxWithOptions(ctx context.Context, tx expanded_tx.TransactionWithOutputs,
+	options SubmitOptions) (*TxSubmitResponse, error) {
+
+	body, err := c.encodeTxs([]expanded_tx.TransactionWithOutputs{tx}, options)
+	if err != nil {
 		return nil, errors.Wrap(err, "serialize")
 	}
+	defer body.release()
 
-	return c.SubmitTxBytes(ctx, buf.Bytes())
+	return c.submitTx(ctx, body, options)
 }
 
 func (c HTTPClient) SubmitTxBytes(ctx context.Context, txBytes []byte) (*TxSubmitResponse, error) {
-	header := make(http.Header)
-	if callBackURL := c.callBackURL.Load().(string); len(callBackURL) > 0 {
-		peerChannel, err := peer_channels.ParseChannel(callBackURL)
-		if err == nil && len(peerChannel.Token) > 0 {
-			header.Set(HeaderKeyCallbackURL, peerChannel.MaskedString())
-			header.Set(HeaderKeyCallbackToken, peerChannel.Token)
-		} else {
-			header.Set(HeaderKeyCallbackURL, callBackURL)
-		}
-		header.Set(HeaderKeyFullStatusUpdates, "true")
+	return c.SubmitTxBytesWithOptions(ctx, txBytes, c.defaultSubmitOptions())
+}
 
-		// When using callbacks don't wait for status beyond received to get response.
-		header.Set(HeaderKeyWaitForStatus, fmt.Sprintf("%d", int(TxStatusReceived)))
+func (c HTTPClient) SubmitTxBytesWithOptions(ctx context.Context, txBytes []byte,
+	options SubmitOptions) (*TxSubmitResponse, error) {
+
+	return c.submitTx(ctx, newTxsBody(txBytes), options)
+}
+
+func (c HTTPClient) submitTx(ctx context.Context, txBody *txsBody,
+	options SubmitOptions) (*TxSubmitResponse, error) {
+
+	body, err := encodeBody(txBody, c.bodyEncoding(options), false)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode")
 	}
 
+	header := c.submitHeader(ctx, options)
+
 	path, err := JoinPath(c.url.Load().(string), PathSubmitTx)
 	if err != nil {
 		return nil, errors.Wrap(err, "join path")
 	}
 
 	response := &TxSubmitResponse{}
-	if err := c.post(path, header, txBytes, response); err != nil {
+	if err := c.post(ctx, path, header, body, response); err != nil {
 		return nil, errors.Wrap(err, "post")
 	}
 
 	return response, nil
 }
 
+// SubmitBEEF submits the subject tx of a BRC-62 BEEF, or BRC-95 atomic BEEF, with its ancestors.
+func (c HTTPClient) SubmitBEEF(ctx context.Context, b *beef.Beef) (*TxSubmitResponse, error) {
+	return c.SubmitBEEFWithOptions(ctx, b, c.defaultSubmitOptions())
+}
+
+func (c HTTPClient) SubmitBEEFWithOptions(ctx context.Context, b *beef.Beef,
+	options SubmitOptions) (*TxSubmitResponse, error) {
+
+	beefBytes, err := b.Bytes()
+	if err != nil {
+		return nil, errors.Wrap(err, "serialize")
+	}
+
+	return c.SubmitTxBytesWithOptions(ctx, beefBytes, options)
+}
+
 func (c HTTPClient) SubmitTxs(ctx context.Context,
 	txs []expanded_tx.TransactionWithOutputs) ([]*TxSubmitResponse, error) {
 
-	buf := &bytes.Buffer{}
-	for i, tx := range txs {
-		if err := tef.Serialize(buf, tx); err != nil {
-			return nil, errors.Wrapf(err, "serialize tx %d", i)
-		}
+	return c.SubmitTxsWithOptions(ctx, txs, c.defaultSubmitOptions())
+}
+
+func (c HTTPClient) SubmitTxsWithOptions(ctx context.Context,
+	txs []expanded_tx.TransactionWithOutputs,
+	options SubmitOptions) ([]*TxSubmitResponse, error) {
+
+	body, err := c.encodeTxs(txs, options)
+	if err != nil {
+		return nil, errors.Wrap(err, "serialize")
 	}
+	defer body.release()
 
-	return c.SubmitTxsBytes(ctx, buf.Bytes())
+	return c.submitTxs(ctx, body, options)
 }
 
 func (c HTTPClient) SubmitTxsBytes(ctx context.Context,
 	txsBytes []byte) ([]*TxSubmitResponse, error) {
 
-	header := make(http.Header)
-	if callBackURL := c.callBackURL.Load().(string); len(callBackURL) > 0 {
-		peerChannel, err := peer_channels.ParseChannel(callBackURL)
-		if err == nil && len(peerChannel.Token) > 0 {
-			header.Set(HeaderKeyCallbackURL, peerChannel.MaskedString())
-			header.Set(HeaderKeyCallbackToken, peerChannel.Token)
-		} else {
-			header.Set(HeaderKeyCallbackURL, callBackURL)
-		}
-		header.Set(HeaderKeyFullStatusUpdates, "true")
+	return c.SubmitTxsBytesWithOptions(ctx, txsBytes, c.defaultSubmitOptions())
+}
 
-		// When using callbacks don't wait for status beyond received to get response.
-		header.Set(HeaderKeyWaitForStatus, fmt.Sprintf("%d", int(TxStatusReceived)))
+func (c HTTPClient) SubmitTxsBytesWithOptions(ctx context.Context, txsBytes []byte,
+	options SubmitOptions) ([]*TxSubmitResponse, error) {
+
+	return c.submitTxs(ctx, newTxsBody(txsBytes), options)
+}
+
+func (c HTTPClient) submitTxs(ctx context.Context, txsBody *txsBody,
+	options SubmitOptions) ([]*TxSubmitResponse, error) {
+
+	body, err := encodeBody(txsBody, c.bodyEncoding(options), true)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode")
 	}
 
+	header := c.submitHeader(ctx, options)
+
 	path, err := JoinPath(c.url.Load().(string), PathSubmitTxs)
 	if err != nil {
 		return nil, errors.Wrap(err, "join path")
 	}
 
 	var response []*TxSubmitResponse
-	if err := c.post(path, header, txsBytes, &response); err != nil {
+	if err := c.post(ctx, path, header, body, &response); err != nil {
 		return nil, errors.Wrap(err, "post")
 	}
 
 	return response, nil
 }
 
-func (c HTTPClient) get(url string, header http.Header, response interface{}) error {
-	httpRequest, err := http.NewRequest(http.MethodGet, url, nil)
+// defaultSubmitOptions returns the options used by the submit functions that don't take options.
+func (c HTTPClient) defaultSubmitOptions() SubmitOptions {
+	if callBackURL := c.callBackURL.Load().(string); len(callBackURL) > 0 {
+		// When using callbacks don't wait for status beyond received to get response.
+		return SubmitOptions{
+			WaitForStatus:     TxStatusReceived,
+			FullStatusUpdates: true,
+		}
+	}
+
+	return SubmitOptions{}
+}
+
+func (c HTTPClient) submitHeader(ctx context.Context, options SubmitOptions) http.Header {
+	header := make(http.Header)
+	switch {
+	case options.NoCallback:
+	case len(options.CallbackURL) > 0:
+		setCallbackHeader(header, options.CallbackURL, options.CallbackToken)
+	default:
+		if callBackURL := c.callBackURL.Load().(string); len(callBackURL) > 0 {
+			setCallbackHeader(header, callBackURL, options.CallbackToken)
+		}
+	}
+
+	if options.FullStatusUpdates {
+		header.Set(HeaderKeyFullStatusUpdates, "true")
+	}
+
+	if options.CallbackBatch {
+		header.Set(HeaderKeyCallbackBatch, "true")
+	}
+
+	if options.WaitForStatus != TxStatusUnknown {
+		header.Set(HeaderKeyWaitForStatus, fmt.Sprintf("%d", int(options.WaitForStatus)))
+	}
+
+	if options.SkipFeeValidation {
+		header.Set(HeaderKeySkipFeeValidation, "true")
+	}
+
+	if options.SkipScriptValidation {
+		header.Set(HeaderKeySkipScriptValidation, "true")
+	}
+
+	if options.SkipTxValidation {
+		header.Set(HeaderKeySkipTxValidation, "true")
+	}
+
+	if options.CumulativeFeeValidation {
+		header.Set(HeaderKeyCumulativeFeeValidation, "true")
+	}
+
+	setMaxTimeout(ctx, header, options.MaxTimeout)
+
+	return header
+}
+
+// setCallbackHeader sets the callback url and token headers. When the url is a peer channel that
+// contains a token the token is removed from the url and sent in the token header. A token
+// specified separately takes precedence over one in the url.
+func setCallbackHeader(header http.Header, callBackURL, callBackToken string) {
+	peerChannel, err := peer_channels.ParseChannel(callBackURL)
+	if err == nil && len(peerChannel.Token) > 0 {
+		header.Set(HeaderKeyCallbackURL, peerChannel.MaskedString())
+		header.Set(HeaderKeyCallbackToken, peerChannel.Token)
+	} else {
+		header.Set(HeaderKeyCallbackURL, callBackURL)
+	}
+
+	if len(callBackToken) > 0 {
+		header.Set(HeaderKeyCallbackToken, callBackToken)
+	}
+}
+
+// setMaxTimeout tells ARC to stop waiting for the requested status when the specified max timeout
+// or the context's deadline passes, whichever is first, so the server gives up at the same time the
+// client does.
+func setMaxTimeout(ctx context.Context, header http.Header, maxTimeout time.Duration) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); maxTimeout == 0 || remaining < maxTimeout {
+			maxTimeout = remaining
+		}
+	}
+
+	if maxTimeout == 0 {
+		return
+	}
+
+	seconds := int(maxTimeout / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	header.Set(HeaderKeyMaxTimeout, fmt.Sprintf("%d", seconds))
+}
+
+// convertRequestError converts an error returned from the http client into ErrCanceled or
+// ErrTimeout when the request was stopped by the context or a timeout.
+func convertRequestError(ctx context.Context, err error, name string) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return errors.Wrap(ErrCanceled, errors.Wrap(err, name).Error())
+	case context.DeadlineExceeded:
+		return errors.Wrap(ErrTimeout, errors.Wrap(err, name).Error())
+	}
+
+	if errors.Cause(err) == context.DeadlineExceeded {
+		return errors.Wrap(ErrTimeout, errors.Wrap(err, name).Error())
+	}
+
+	if netErr, ok := errors.Cause(err).(net.Error); ok && netErr.Timeout() {
+		return errors.Wrap(ErrTimeout, errors.Wrap(err, name).Error())
+	}
+
+	return errors.Wrap(err, name)
+}
+
+func (c HTTPClient) get(ctx context.Context, url string, header http.Header,
+	response interface{}) error {
+
+	return c.retry(ctx, func() error {
+		return c.getAttempt(ctx, url, header, response)
+	})
+}
+
+func (c HTTPClient) getAttempt(ctx context.Context, url string, header http.Header,
+	response interface{}) error {
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return errors.Wrap(err, "create request")
 	}
@@ -253,35 +539,17 @@ func (c HTTPClient) get(url string, header http.Header, response interface{}) er
 
 	httpResponse, err := c.httpClient.Do(httpRequest)
 	if err != nil {
-		if errors.Cause(err) == context.DeadlineExceeded {
-			return errors.Wrap(ErrTimeout, errors.Wrap(err, "http get").Error())
-		}
-		return errors.Wrap(err, "http get")
+		return convertRequestError(ctx, err, "http get")
 	}
 
-	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
-		result := HTTPError{Status: httpResponse.StatusCode}
-
-		if httpResponse.Body != nil {
-			b, rerr := ioutil.ReadAll(httpResponse.Body)
-			if rerr == nil {
-				result.Message = string(b)
-			}
-		}
-
-		if httpResponse.StatusCode == http.StatusGatewayTimeout {
-			return errors.Wrap(ErrTimeout, errors.Wrap(result, "http post").Error())
-		}
+	defer httpResponse.Body.Close()
 
-		if description, exists := httpStatusDescriptions[httpResponse.StatusCode]; exists {
-			result.Description = description
-		}
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
+		result := newHTTPError(httpResponse)
 
 		return result
 	}
 
-	defer httpResponse.Body.Close()
-
 	if response != nil {
 		b, rerr := ioutil.ReadAll(httpResponse.Body)
 		if rerr == nil {
@@ -298,7 +566,17 @@ func (c HTTPClient) get(url string, header http.Header, response interface{}) er
 	return nil
 }
 
-func (c HTTPClient) post(url string, header http.Header, request, response interface{}) error {
+func (c HTTPClient) post(ctx context.Context, url string, header http.Header,
+	request, response interface{}) error {
+
+	return c.retry(ctx, func() error {
+		return c.postAttempt(ctx, url, header, request, response)
+	})
+}
+
+func (c HTTPClient) postAttempt(ctx context.Context, url string, header http.Header,
+	request, response interface{}) error {
+
 	var requestReader io.Reader
 	if request != nil {
 		switch v := request.(type) {
@@ -310,6 +588,10 @@ func (c HTTPClient) post(url string, header http.Header, request, response inter
 			// request is already a byte slice, not an object to convert to json
 			requestReader = bytes.NewReader(v)
 			header.Set("Content-Type", "application/octet-stream")
+		case *txsBody:
+			// the txs can be in a pooled buffer that is held until the request body is closed
+			requestReader = v.reader()
+			header.Set("Content-Type", "application/octet-stream")
 		default:
 			buf := &bytes.Buffer{}
 			encoder := json.NewEncoder(buf)
@@ -325,11 +607,21 @@ func (c HTTPClient) post(url string, header http.Header, request, response inter
 		header.Set("Authorization", authToken)
 	}
 
-	httpRequest, err := http.NewRequest(http.MethodPost, url, requestReader)
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, url, requestReader)
 	if err != nil {
+		if closer, ok := requestReader.(io.Closer); ok {
+			closer.Close()
+		}
 		return errors.Wrap(err, "create request")
 	}
 
+	if body, ok := request.(*txsBody); ok {
+		httpRequest.ContentLength = int64(len(body.b))
+		httpRequest.GetBody = func() (io.ReadCloser, error) {
+			return body.reader(), nil
+		}
+	}
+
 	for key, values := range header {
 		for _, value := range values {
 			httpRequest.Header.Add(key, value)
@@ -338,35 +630,17 @@ func (c HTTPClient) post(url string, header http.Header, request, response inter
 
 	httpResponse, err := c.httpClient.Do(httpRequest)
 	if err != nil {
-		if errors.Cause(err) == context.DeadlineExceeded {
-			return errors.Wrap(ErrTimeout, errors.Wrap(err, "http post").Error())
-		}
-		return errors.Wrap(err, "http post")
+		return convertRequestError(ctx, err, "http post")
 	}
 
-	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
-		result := HTTPError{Status: httpResponse.StatusCode}
-
-		if httpResponse.Body != nil {
-			b, rerr := ioutil.ReadAll(httpResponse.Body)
-			if rerr == nil {
-				result.Message = string(b)
-			}
-		}
-
-		if httpResponse.StatusCode == http.StatusGatewayTimeout {
-			return errors.Wrap(ErrTimeout, errors.Wrap(result, "http post").Error())
-		}
+	defer httpResponse.Body.Close()
 
-		if description, exists := httpStatusDescriptions[httpResponse.StatusCode]; exists {
-			result.Description = description
-		}
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
+		result := newHTTPError(httpResponse)
 
 		return result
 	}
 
-	defer httpResponse.Body.Close()
-
 	if response != nil {
 		b, rerr := ioutil.ReadAll(httpResponse.Body)
 		if rerr == nil {
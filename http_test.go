@@ -0,0 +1,364 @@
+package arc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tokenized/pkg/peer_channels"
+
+	"github.com/pkg/errors"
+)
+
+func Test_HTTPClient_ContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "", "", DefaultConfig())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := client.GetPolicy(ctx)
+	if err == nil {
+		t.Fatalf("Get policy should fail")
+	}
+
+	t.Logf("Error : %s", err)
+	if errors.Cause(err) != ErrCanceled {
+		t.Fatalf("Wrong error : got %s, want %s", errors.Cause(err), ErrCanceled)
+	}
+}
+
+func Test_HTTPClient_ContextDeadline(t *testing.T) {
+	maxTimeout := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxTimeout <- r.Header.Get(HeaderKeyMaxTimeout)
+		ioutil.ReadAll(r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "", "", DefaultConfig())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err := client.SubmitTxBytes(ctx, []byte{0x01})
+	if err == nil {
+		t.Fatalf("Submit should fail")
+	}
+
+	t.Logf("Error : %s", err)
+	if errors.Cause(err) != ErrTimeout {
+		t.Fatalf("Wrong error : got %s, want %s", errors.Cause(err), ErrTimeout)
+	}
+
+	if header := <-maxTimeout; header != "1" {
+		t.Fatalf("Wrong max timeout header : got %s, want %s", header, "1")
+	}
+}
+
+func Test_HTTPClient_SubmitOptions(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "", "", DefaultConfig())
+
+	options := SubmitOptions{
+		WaitForStatus:           TxStatusSeen,
+		MaxTimeout:              10 * time.Second,
+		SkipFeeValidation:       true,
+		SkipScriptValidation:    true,
+		CumulativeFeeValidation: true,
+		CallbackBatch:           true,
+	}
+
+	if _, err := client.SubmitTxsBytesWithOptions(context.Background(), []byte{0x01},
+		options); err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	header := <-headers
+	wants := map[string]string{
+		HeaderKeyWaitForStatus:           "8",
+		HeaderKeyMaxTimeout:              "10",
+		HeaderKeySkipFeeValidation:       "true",
+		HeaderKeySkipScriptValidation:    "true",
+		HeaderKeySkipTxValidation:        "",
+		HeaderKeyCumulativeFeeValidation: "true",
+		HeaderKeyCallbackBatch:           "true",
+		HeaderKeyFullStatusUpdates:       "",
+	}
+
+	for key, want := range wants {
+		if got := header.Get(key); got != want {
+			t.Errorf("Wrong %s header : got %q, want %q", key, got, want)
+		}
+	}
+}
+
+func Test_HTTPClient_PerCallCallback(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	clientChannel := peer_channels.Channel{
+		BaseURL:   "https://peer.test",
+		ChannelID: "client",
+		Token:     "client_token",
+	}
+	client := NewHTTPClient(server.URL, "", clientChannel.String(), DefaultConfig())
+
+	txChannel := peer_channels.Channel{
+		BaseURL:   "https://peer.test",
+		ChannelID: "customer",
+		Token:     "customer_token",
+	}
+
+	tests := []struct {
+		name    string
+		options SubmitOptions
+		url     string
+		token   string
+		waitFor string
+	}{
+		{
+			name:    "client default",
+			options: client.defaultSubmitOptions(),
+			url:     clientChannel.MaskedString(),
+			token:   "client_token",
+			waitFor: "2",
+		},
+		{
+			name: "per tx peer channel",
+			options: SubmitOptions{
+				CallbackURL: txChannel.String(),
+			},
+			url:   txChannel.MaskedString(),
+			token: "customer_token",
+		},
+		{
+			name: "per tx url and token",
+			options: SubmitOptions{
+				CallbackURL:   "https://callback.test/arc",
+				CallbackToken: "tx_token",
+			},
+			url:   "https://callback.test/arc",
+			token: "tx_token",
+		},
+		{
+			name: "per tx token with client url",
+			options: SubmitOptions{
+				CallbackToken: "tx_token",
+			},
+			url:   clientChannel.MaskedString(),
+			token: "tx_token",
+		},
+		{
+			name: "no callback",
+			options: SubmitOptions{
+				CallbackURL:   txChannel.String(),
+				CallbackToken: "tx_token",
+				NoCallback:    true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := client.SubmitTxBytesWithOptions(context.Background(), []byte{0x01},
+				tt.options); err != nil {
+				t.Fatalf("Failed to submit : %s", err)
+			}
+
+			header := <-headers
+			if got := header.Get(HeaderKeyCallbackURL); got != tt.url {
+				t.Errorf("Wrong callback url : got %s, want %s", got, tt.url)
+			}
+
+			if got := header.Get(HeaderKeyCallbackToken); got != tt.token {
+				t.Errorf("Wrong callback token : got %s, want %s", got, tt.token)
+			}
+
+			if got := header.Get(HeaderKeyWaitForStatus); got != tt.waitFor {
+				t.Errorf("Wrong wait for status : got %s, want %s", got, tt.waitFor)
+			}
+		})
+	}
+}
+
+func Test_HTTPClient_ErrorData(t *testing.T) {
+	txid := "a3f8b2f2d4bd8f0e7d8e3c0c4fe4e7c1c2b1b2a9f8e7d6c5b4a3f2e1d0c9b8a7"
+	server := newTestSubmitServer(465, `{
+		"type": "https://bitcoin-sv.github.io/arc/#/errors?id=_465",
+		"title": "Fee too low",
+		"status": 465,
+		"detail": "The fees are too low",
+		"txid": "`+txid+`",
+		"extraInfo": "fee 10 < 50"
+	}`)
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "", "", DefaultConfig())
+
+	_, err := client.SubmitTxBytes(context.Background(), []byte{0x01})
+	if err == nil {
+		t.Fatalf("Submit should fail")
+	}
+
+	t.Logf("Error : %s", err)
+
+	if !errors.Is(err, ErrFeeTooLow) {
+		t.Errorf("Error should be %s", ErrFeeTooLow)
+	}
+
+	if errors.Is(err, ErrMalformedTx) {
+		t.Errorf("Error should not be %s", ErrMalformedTx)
+	}
+
+	if !IsInvalidTxError(err) {
+		t.Errorf("Error should be an invalid tx error")
+	}
+
+	var httpError HTTPError
+	if !errors.As(err, &httpError) {
+		t.Fatalf("Error should be an HTTPError")
+	}
+
+	if httpError.Data == nil {
+		t.Fatalf("Missing error data")
+	}
+
+	if httpError.Data.Title != "Fee too low" {
+		t.Errorf("Wrong title : got %s, want %s", httpError.Data.Title, "Fee too low")
+	}
+
+	if httpError.TxID() == nil || httpError.TxID().String() != txid {
+		t.Errorf("Wrong txid : got %v, want %s", httpError.TxID(), txid)
+	}
+
+	if httpError.ExtraInfo() != "fee 10 < 50" {
+		t.Errorf("Wrong extra info : got %s, want %s", httpError.ExtraInfo(), "fee 10 < 50")
+	}
+}
+
+func Test_HTTPClient_ErrorNotProblem(t *testing.T) {
+	server := newTestSubmitServer(http.StatusUnauthorized, `not authorized`)
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "", "", DefaultConfig())
+
+	_, err := client.GetPolicy(context.Background())
+	if err == nil {
+		t.Fatalf("Get policy should fail")
+	}
+
+	t.Logf("Error : %s", err)
+
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Error should be %s", ErrUnauthorized)
+	}
+
+	var httpError HTTPError
+	if !errors.As(err, &httpError) {
+		t.Fatalf("Error should be an HTTPError")
+	}
+
+	if httpError.Data != nil {
+		t.Errorf("Error data should be nil")
+	}
+
+	if httpError.Message != "not authorized" {
+		t.Errorf("Wrong message : got %s, want %s", httpError.Message, "not authorized")
+	}
+}
+
+func Test_HTTPClient_GatewayTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGatewayTimeout)
+		w.Write([]byte(`{"status":504,"title":"Gateway timeout"}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "", "", DefaultConfig())
+
+	_, err := client.SubmitTxBytes(context.Background(), []byte{0x01})
+	if err == nil {
+		t.Fatalf("Submit should fail")
+	}
+
+	t.Logf("Error : %s", err)
+
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Error should be %s", ErrTimeout)
+	}
+
+	if !IsRetryableError(err) {
+		t.Errorf("Error should be retryable")
+	}
+
+	var httpError HTTPError
+	if !errors.As(err, &httpError) {
+		t.Fatalf("Error should be an HTTPError")
+	}
+
+	if httpError.Status != http.StatusGatewayTimeout {
+		t.Errorf("Wrong status : got %d, want %d", httpError.Status, http.StatusGatewayTimeout)
+	}
+
+	if httpError.Data == nil || httpError.Data.Title != "Gateway timeout" {
+		t.Errorf("Wrong error data : %+v", httpError.Data)
+	}
+}
+
+func Test_ClassifyError(t *testing.T) {
+	tests := []struct {
+		err   error
+		class ErrorClass
+	}{
+		{HTTPError{Status: 461}, ErrorClassTxInvalid},
+		{HTTPError{Status: 465}, ErrorClassTxInvalid},
+		{HTTPError{Status: 466}, ErrorClassTxInvalid},
+		{HTTPError{Status: 473}, ErrorClassTxInvalid},
+		{HTTPError{Status: 460}, ErrorClassClientBug},
+		{HTTPError{Status: 467}, ErrorClassClientBug},
+		{HTTPError{Status: 475}, ErrorClassClientBug},
+		{HTTPError{Status: 476}, ErrorClassClientBug},
+		{HTTPError{Status: http.StatusNotFound}, ErrorClassNotFound},
+		{HTTPError{Status: http.StatusUnauthorized}, ErrorClassAuth},
+		{HTTPError{Status: http.StatusInternalServerError}, ErrorClassRetryable},
+		{HTTPError{Status: http.StatusServiceUnavailable}, ErrorClassRetryable},
+		{errors.Wrap(HTTPError{Status: http.StatusBadGateway}, "post"), ErrorClassRetryable},
+		{errors.Wrap(ErrTimeout, "post"), ErrorClassRetryable},
+		{errors.Wrap(ErrCanceled, "post"), ErrorClassUnknown},
+		{HTTPError{Status: 499}, ErrorClassUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if class := ClassifyError(tt.err); class != tt.class {
+				t.Errorf("Wrong class : got %s, want %s", class, tt.class)
+			}
+		})
+	}
+
+	if !errors.Is(HTTPError{Status: 466}, ErrConflictingTx) {
+		t.Errorf("Status 466 should be %s", ErrConflictingTx)
+	}
+}
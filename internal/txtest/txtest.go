@@ -0,0 +1,57 @@
+// Package txtest creates txs for tests.
+package txtest
+
+import (
+	"math/rand"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+	"github.com/tokenized/pkg/wire"
+)
+
+const (
+	// ParentValue is the value of the output of each parent created by NewExpandedTx.
+	ParentValue = uint64(10000)
+)
+
+// NewTx returns a tx that spends output 0 of each parent, or a random outpoint when there are no
+// parents, and has an output to a new key for each value.
+func NewTx(parents []*wire.MsgTx, values ...uint64) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	for _, parent := range parents {
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(parent.TxHash(), 0), nil))
+	}
+
+	if len(parents) == 0 {
+		var hash bitcoin.Hash32
+		rand.Read(hash[:])
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, 0), nil))
+	}
+
+	for _, value := range values {
+		key, _ := bitcoin.GenerateKey(bitcoin.MainNet)
+		lockingScript, _ := key.LockingScript()
+		tx.AddTxOut(wire.NewTxOut(value, lockingScript))
+	}
+
+	return tx
+}
+
+// NewExpandedTx returns a tx that spends inputCount new parents, which are its ancestors, and has
+// an output for each value. Each parent has one output of ParentValue.
+func NewExpandedTx(inputCount int, values ...uint64) *expanded_tx.ExpandedTx {
+	var parents []*wire.MsgTx
+	var ancestors expanded_tx.AncestorTxs
+	for i := 0; i < inputCount; i++ {
+		parent := NewTx(nil, ParentValue)
+		parents = append(parents, parent)
+		ancestors = append(ancestors, &expanded_tx.AncestorTx{
+			Tx: parent,
+		})
+	}
+
+	return &expanded_tx.ExpandedTx{
+		Tx:        NewTx(parents, values...),
+		Ancestors: ancestors,
+	}
+}
@@ -0,0 +1,429 @@
+package arc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrQuorumNotReached = errors.New("Quorum Not Reached")
+	ErrNoClients        = errors.New("No Clients")
+
+	// ErrPending is the error of an endpoint's result when the quorum was reached before the
+	// endpoint responded. The submission to the endpoint continues in the background.
+	ErrPending = errors.New("Pending")
+)
+
+// MultiClient is a Client that submits txs to several ARC endpoints concurrently and succeeds when
+// a quorum of them accept. Status and policy requests are sent to each endpoint in order until one
+// succeeds.
+type MultiClient struct {
+	clients []Client
+	quorum  int
+}
+
+// SubmitResult is the result of a submission to one endpoint of a MultiClient.
+type SubmitResult struct {
+	URL       string
+	Response  *TxSubmitResponse   // set for single tx submissions
+	Responses []*TxSubmitResponse // set for batch submissions
+	Err       error
+}
+
+// QuorumError is returned when fewer than the quorum of endpoints accept a submission. It contains
+// the results from every endpoint.
+type QuorumError struct {
+	Accepted int
+	Quorum   int
+	Results  []*SubmitResult
+}
+
+type indexedSubmitResult struct {
+	index  int
+	result *SubmitResult
+}
+
+// NewMultiClient creates a client that fans submissions out to all of the clients. quorum is the
+// number of clients that must accept a submission for it to succeed. It is limited to the range
+// from one to the number of clients.
+func NewMultiClient(clients []Client, quorum int) *MultiClient {
+	if quorum < 1 {
+		quorum = 1
+	}
+	if quorum > len(clients) {
+		quorum = len(clients)
+	}
+
+	return &MultiClient{
+		clients: clients,
+		quorum:  quorum,
+	}
+}
+
+func (err QuorumError) Error() string {
+	var failures []string
+	for _, result := range err.Results {
+		if result.Err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", result.URL, result.Err))
+		} else if !result.Accepted() {
+			failures = append(failures, fmt.Sprintf("%s: %s", result.URL, TxStatusRejected))
+		}
+	}
+
+	result := fmt.Sprintf("%s : %d of %d accepted", ErrQuorumNotReached, err.Accepted, err.Quorum)
+	if len(failures) > 0 {
+		result = fmt.Sprintf("%s : %s", result, strings.Join(failures, ", "))
+	}
+
+	return result
+}
+
+// Is makes errors.Is(err, ErrQuorumNotReached) true for a QuorumError.
+func (err QuorumError) Is(target error) bool {
+	return target == ErrQuorumNotReached
+}
+
+// Accepted returns true if the endpoint accepted the submission. A batch is accepted when at least
+// one of its txs isn't rejected.
+func (r SubmitResult) Accepted() bool {
+	if r.Err != nil {
+		return false
+	}
+
+	if r.Response != nil {
+		return r.Response.TxStatus != TxStatusRejected
+	}
+
+	for _, response := range r.Responses {
+		if response != nil && response.TxStatus != TxStatusRejected {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rejected returns true if the endpoint responded that the tx is invalid.
+func (r SubmitResult) Rejected() bool {
+	if r.Err != nil {
+		return IsInvalidTxError(errors.Cause(r.Err))
+	}
+
+	return r.Response != nil && r.Response.TxStatus == TxStatusRejected
+}
+
+// TimedOut returns true if the endpoint didn't respond in time.
+func (r SubmitResult) TimedOut() bool {
+	return r.Err != nil && errors.Is(r.Err, ErrTimeout)
+}
+
+// URL returns the urls of all of the clients separated by commas.
+func (c *MultiClient) URL() string {
+	urls := make([]string, len(c.clients))
+	for i, client := range c.clients {
+		urls[i] = client.URL()
+	}
+
+	return strings.Join(urls, ",")
+}
+
+func (c *MultiClient) Clients() []Client {
+	return c.clients
+}
+
+func (c *MultiClient) GetPolicy(ctx context.Context) (*Policy, error) {
+	var errs EndpointErrors
+	for _, client := range c.clients {
+		policy, err := client.GetPolicy(ctx)
+		if err == nil {
+			return policy, nil
+		}
+
+		errs = append(errs, EndpointError{URL: client.URL(), Err: err})
+	}
+
+	if len(errs) == 0 {
+		return nil, ErrNoClients
+	}
+
+	return nil, errs
+}
+
+func (c *MultiClient) GetTxStatus(ctx context.Context,
+	txid bitcoin.Hash32) (*TxStatusResponse, error) {
+
+	var errs EndpointErrors
+	for _, client := range c.clients {
+		response, err := client.GetTxStatus(ctx, txid)
+		if err == nil {
+			return response, nil
+		}
+
+		errs = append(errs, EndpointError{URL: client.URL(), Err: err})
+	}
+
+	if len(errs) == 0 {
+		return nil, ErrNoClients
+	}
+
+	return nil, errs
+}
+
+func (c *MultiClient) SubmitTx(ctx context.Context,
+	tx expanded_tx.TransactionWithOutputs) (*TxSubmitResponse, error) {
+
+	return firstAcceptedResponse(c.SubmitTxResults(ctx, tx))
+}
+
+func (c *MultiClient) SubmitTxWithOptions(ctx context.Context,
+	tx expanded_tx.TransactionWithOutputs, options SubmitOptions) (*TxSubmitResponse, error) {
+
+	return firstAcceptedResponse(c.SubmitTxWithOptionsResults(ctx, tx, options))
+}
+
+func (c *MultiClient) SubmitTxBytes(ctx context.Context,
+	txBytes []byte) (*TxSubmitResponse, error) {
+
+	return firstAcceptedResponse(c.SubmitTxBytesResults(ctx, txBytes))
+}
+
+func (c *MultiClient) SubmitTxBytesWithOptions(ctx context.Context, txBytes []byte,
+	options SubmitOptions) (*TxSubmitResponse, error) {
+
+	return firstAcceptedResponse(c.SubmitTxBytesWithOptionsResults(ctx, txBytes, options))
+}
+
+func (c *MultiClient) SubmitTxs(ctx context.Context,
+	txs []expanded_tx.TransactionWithOutputs) ([]*TxSubmitResponse, error) {
+
+	return firstAcceptedResponses(c.SubmitTxsResults(ctx, txs))
+}
+
+func (c *MultiClient) SubmitTxsWithOptions(ctx context.Context,
+	txs []expanded_tx.TransactionWithOutputs,
+	options SubmitOptions) ([]*TxSubmitResponse, error) {
+
+	return firstAcceptedResponses(c.SubmitTxsWithOptionsResults(ctx, txs, options))
+}
+
+func (c *MultiClient) SubmitTxsBytes(ctx context.Context,
+	txsBytes []byte) ([]*TxSubmitResponse, error) {
+
+	return firstAcceptedResponses(c.SubmitTxsBytesResults(ctx, txsBytes))
+}
+
+func (c *MultiClient) SubmitTxsBytesWithOptions(ctx context.Context, txsBytes []byte,
+	options SubmitOptions) ([]*TxSubmitResponse, error) {
+
+	return firstAcceptedResponses(c.SubmitTxsBytesWithOptionsResults(ctx, txsBytes, options))
+}
+
+// SubmitTxResults submits the tx to all endpoints concurrently and returns the result from each
+// endpoint in the same order as the clients. Each client serializes the tx in its own format. See
+// SubmitTxBytesResults.
+func (c *MultiClient) SubmitTxResults(ctx context.Context,
+	tx expanded_tx.TransactionWithOutputs) ([]*SubmitResult, error) {
+
+	return c.fanOut(func(client Client, result *SubmitResult) {
+		result.Response, result.Err = client.SubmitTx(ctx, tx)
+	})
+}
+
+// SubmitTxWithOptionsResults is the same as SubmitTxResults, but with the specified submit
+// options.
+func (c *MultiClient) SubmitTxWithOptionsResults(ctx context.Context,
+	tx expanded_tx.TransactionWithOutputs, options SubmitOptions) ([]*SubmitResult, error) {
+
+	return c.fanOut(func(client Client, result *SubmitResult) {
+		optionsClient, err := asOptionsClient(client)
+		if err != nil {
+			result.Err = err
+			return
+		}
+
+		result.Response, result.Err = optionsClient.SubmitTxWithOptions(ctx, tx, options)
+	})
+}
+
+// SubmitTxsResults submits the txs to all endpoints concurrently and returns the result from each
+// endpoint in the same order as the clients. Each client serializes the txs in its own format. See
+// SubmitTxsBytesResults.
+func (c *MultiClient) SubmitTxsResults(ctx context.Context,
+	txs []expanded_tx.TransactionWithOutputs) ([]*SubmitResult, error) {
+
+	return c.fanOut(func(client Client, result *SubmitResult) {
+		result.Responses, result.Err = client.SubmitTxs(ctx, txs)
+	})
+}
+
+// SubmitTxsWithOptionsResults is the same as SubmitTxsResults, but with the specified submit
+// options.
+func (c *MultiClient) SubmitTxsWithOptionsResults(ctx context.Context,
+	txs []expanded_tx.TransactionWithOutputs, options SubmitOptions) ([]*SubmitResult, error) {
+
+	return c.fanOut(func(client Client, result *SubmitResult) {
+		optionsClient, err := asOptionsClient(client)
+		if err != nil {
+			result.Err = err
+			return
+		}
+
+		result.Responses, result.Err = optionsClient.SubmitTxsWithOptions(ctx, txs, options)
+	})
+}
+
+// SubmitTxBytesResults submits the tx to all endpoints concurrently and returns the result from
+// each endpoint in the same order as the clients. It returns as soon as the quorum accepts and the
+// results of endpoints that haven't responded yet have ErrPending. A QuorumError is returned along
+// with the results when fewer than the quorum accept.
+func (c *MultiClient) SubmitTxBytesResults(ctx context.Context,
+	txBytes []byte) ([]*SubmitResult, error) {
+
+	return c.fanOut(func(client Client, result *SubmitResult) {
+		result.Response, result.Err = client.SubmitTxBytes(ctx, txBytes)
+	})
+}
+
+// SubmitTxBytesWithOptionsResults is the same as SubmitTxBytesResults, but with the specified
+// submit options.
+func (c *MultiClient) SubmitTxBytesWithOptionsResults(ctx context.Context, txBytes []byte,
+	options SubmitOptions) ([]*SubmitResult, error) {
+
+	return c.fanOut(func(client Client, result *SubmitResult) {
+		optionsClient, err := asOptionsClient(client)
+		if err != nil {
+			result.Err = err
+			return
+		}
+
+		result.Response, result.Err = optionsClient.SubmitTxBytesWithOptions(ctx, txBytes,
+			options)
+	})
+}
+
+// SubmitTxsBytesResults submits the txs to all endpoints concurrently and returns the result from
+// each endpoint in the same order as the clients. It returns as soon as the quorum accepts and the
+// results of endpoints that haven't responded yet have ErrPending. A QuorumError is returned along
+// with the results when fewer than the quorum accept.
+func (c *MultiClient) SubmitTxsBytesResults(ctx context.Context,
+	txsBytes []byte) ([]*SubmitResult, error) {
+
+	return c.fanOut(func(client Client, result *SubmitResult) {
+		result.Responses, result.Err = client.SubmitTxsBytes(ctx, txsBytes)
+	})
+}
+
+// SubmitTxsBytesWithOptionsResults is the same as SubmitTxsBytesResults, but with the specified
+// submit options.
+func (c *MultiClient) SubmitTxsBytesWithOptionsResults(ctx context.Context, txsBytes []byte,
+	options SubmitOptions) ([]*SubmitResult, error) {
+
+	return c.fanOut(func(client Client, result *SubmitResult) {
+		optionsClient, err := asOptionsClient(client)
+		if err != nil {
+			result.Err = err
+			return
+		}
+
+		result.Responses, result.Err = optionsClient.SubmitTxsBytesWithOptions(ctx, txsBytes,
+			options)
+	})
+}
+
+// asOptionsClient returns ErrOptionsNotSupported when the client doesn't implement OptionsClient
+// so options aren't silently ignored.
+func asOptionsClient(client Client) (OptionsClient, error) {
+	optionsClient, ok := client.(OptionsClient)
+	if !ok {
+		return nil, errors.Wrap(ErrOptionsNotSupported, client.URL())
+	}
+
+	return optionsClient, nil
+}
+
+func firstAcceptedResponse(results []*SubmitResult, err error) (*TxSubmitResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		if result.Accepted() {
+			return result.Response, nil
+		}
+	}
+
+	return nil, QuorumError{Results: results}
+}
+
+func firstAcceptedResponses(results []*SubmitResult, err error) ([]*TxSubmitResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		if result.Accepted() {
+			return result.Responses, nil
+		}
+	}
+
+	return nil, QuorumError{Results: results}
+}
+
+// fanOut submits to every endpoint concurrently and returns once the quorum accepts or every
+// endpoint has responded.
+func (c *MultiClient) fanOut(submit func(Client, *SubmitResult)) ([]*SubmitResult, error) {
+	if len(c.clients) == 0 {
+		return nil, ErrNoClients
+	}
+
+	// Buffered so submissions that finish after the quorum is reached don't block.
+	done := make(chan indexedSubmitResult, len(c.clients))
+	for i, client := range c.clients {
+		go func(index int, client Client) {
+			result := &SubmitResult{
+				URL: client.URL(),
+			}
+			submit(client, result)
+			done <- indexedSubmitResult{index: index, result: result}
+		}(i, client)
+	}
+
+	results := make([]*SubmitResult, len(c.clients))
+	accepted := 0
+	for range c.clients {
+		indexed := <-done
+		results[indexed.index] = indexed.result
+
+		if indexed.result.Accepted() {
+			accepted++
+			if accepted >= c.quorum {
+				break
+			}
+		}
+	}
+
+	if accepted < c.quorum {
+		return results, QuorumError{
+			Accepted: accepted,
+			Quorum:   c.quorum,
+			Results:  results,
+		}
+	}
+
+	for i, result := range results {
+		if result == nil {
+			results[i] = &SubmitResult{
+				URL: c.clients[i].URL(),
+				Err: ErrPending,
+			}
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,244 @@
+package arc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tokenized/arc/internal/txtest"
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/pkg/errors"
+)
+
+func newTestSubmitServer(status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func Test_MultiClient_Quorum(t *testing.T) {
+	accept1 := newTestSubmitServer(http.StatusOK, `{"txStatus":"SEEN_ON_NETWORK"}`)
+	defer accept1.Close()
+	accept2 := newTestSubmitServer(http.StatusOK, `{"txStatus":"STORED"}`)
+	defer accept2.Close()
+	reject := newTestSubmitServer(465, `{"status":465,"title":"Fee too low"}`)
+	defer reject.Close()
+
+	cfg := testRetryConfig()
+	clients := []Client{
+		NewHTTPClient(reject.URL, "", "", cfg),
+		NewHTTPClient(accept1.URL, "", "", cfg),
+		NewHTTPClient(accept2.URL, "", "", cfg),
+	}
+
+	response, err := NewMultiClient(clients, 2).SubmitTxBytes(context.Background(), []byte{0x01})
+	if err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	if response.TxStatus != TxStatusSeen {
+		t.Fatalf("Wrong tx status : got %s, want %s", response.TxStatus, TxStatusSeen)
+	}
+
+	results, err := NewMultiClient(clients, 3).SubmitTxBytesResults(context.Background(),
+		[]byte{0x01})
+	if err == nil {
+		t.Fatalf("Submit should not reach quorum")
+	}
+
+	t.Logf("Error : %s", err)
+	if !errors.Is(err, ErrQuorumNotReached) {
+		t.Fatalf("Wrong error : got %s, want %s", err, ErrQuorumNotReached)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Wrong result count : got %d, want %d", len(results), 3)
+	}
+
+	if !results[0].Rejected() {
+		t.Errorf("First endpoint should be rejected : %s", results[0].Err)
+	}
+
+	if !results[1].Accepted() || !results[2].Accepted() {
+		t.Errorf("Second and third endpoints should be accepted")
+	}
+}
+
+func Test_MultiClient_RejectedBatch(t *testing.T) {
+	reject := newTestSubmitServer(http.StatusOK,
+		`[{"txStatus":"REJECTED"},{"txStatus":"REJECTED"}]`)
+	defer reject.Close()
+	accept := newTestSubmitServer(http.StatusOK, `[{"txStatus":"STORED"},{"txStatus":"REJECTED"}]`)
+	defer accept.Close()
+
+	cfg := testRetryConfig()
+	clients := []Client{
+		NewHTTPClient(reject.URL, "", "", cfg),
+		NewHTTPClient(accept.URL, "", "", cfg),
+	}
+
+	results, err := NewMultiClient(clients, 2).SubmitTxsBytesResults(context.Background(),
+		[]byte{0x01})
+	if !errors.Is(err, ErrQuorumNotReached) {
+		t.Fatalf("Wrong error : got %v, want %s", err, ErrQuorumNotReached)
+	}
+	t.Logf("Error : %s", err)
+
+	if results[0].Accepted() {
+		t.Errorf("Batch with every tx rejected should not be accepted")
+	}
+
+	if !results[1].Accepted() {
+		t.Errorf("Batch with an accepted tx should be accepted")
+	}
+}
+
+func Test_MultiClient_QuorumEarlyReturn(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"txStatus":"STORED"}`))
+	}))
+	defer slow.Close()
+	defer close(release)
+	accept := newTestSubmitServer(http.StatusOK, `{"txStatus":"SEEN_ON_NETWORK"}`)
+	defer accept.Close()
+
+	cfg := testRetryConfig()
+	clients := []Client{
+		NewHTTPClient(slow.URL, "", "", cfg),
+		NewHTTPClient(accept.URL, "", "", cfg),
+	}
+
+	results, err := NewMultiClient(clients, 1).SubmitTxBytesResults(context.Background(),
+		[]byte{0x01})
+	if err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	if errors.Cause(results[0].Err) != ErrPending {
+		t.Errorf("Wrong slow endpoint error : got %v, want %s", results[0].Err, ErrPending)
+	}
+
+	if !results[1].Accepted() {
+		t.Errorf("Second endpoint should be accepted")
+	}
+}
+
+func Test_MultiClient_GetTxStatusErrors(t *testing.T) {
+	notFound := newTestSubmitServer(http.StatusNotFound, `{"status":404,"title":"Not found"}`)
+	defer notFound.Close()
+	unavailable := newTestSubmitServer(http.StatusServiceUnavailable, "")
+	defer unavailable.Close()
+
+	clients := []Client{
+		NewHTTPClient(unavailable.URL, "", "", DefaultConfig()),
+		NewHTTPClient(notFound.URL, "", "", DefaultConfig()),
+	}
+
+	_, err := NewMultiClient(clients, 1).GetTxStatus(context.Background(), bitcoin.Hash32{})
+	if err == nil {
+		t.Fatalf("Get tx status should fail")
+	}
+	t.Logf("Error : %s", err)
+
+	if !IsRetryableError(err) {
+		t.Errorf("Wrong error class : got %s, want %s", ClassifyError(err),
+			ErrorClassRetryable)
+	}
+
+	var httpError HTTPError
+	if !errors.As(err, &httpError) {
+		t.Fatalf("Error should contain an HTTPError")
+	}
+
+	if httpError.Status != http.StatusServiceUnavailable {
+		t.Errorf("Wrong status : got %d, want %d", httpError.Status,
+			http.StatusServiceUnavailable)
+	}
+
+	var endpointErrors EndpointErrors
+	if !errors.As(err, &endpointErrors) || len(endpointErrors) != 2 {
+		t.Fatalf("Error should contain both endpoint errors")
+	}
+
+	var notFoundError HTTPError
+	if !errors.As(endpointErrors[1], &notFoundError) ||
+		notFoundError.Status != http.StatusNotFound {
+		t.Errorf("Wrong second endpoint error : %s", endpointErrors[1])
+	}
+}
+
+// plainClient hides the options methods of a client.
+type plainClient struct {
+	Client
+}
+
+func Test_MultiClient_OptionsNotSupported(t *testing.T) {
+	server := newTestSubmitServer(http.StatusOK, `{"txStatus":"STORED"}`)
+	defer server.Close()
+
+	clients := []Client{
+		NewHTTPClient(server.URL, "", "", DefaultConfig()),
+		plainClient{NewHTTPClient(server.URL, "", "", DefaultConfig())},
+	}
+
+	results, err := NewMultiClient(clients, 2).SubmitTxBytesWithOptionsResults(
+		context.Background(), []byte{0x01}, SubmitOptions{SkipFeeValidation: true})
+	if !errors.Is(err, ErrQuorumNotReached) {
+		t.Fatalf("Wrong error : got %v, want %s", err, ErrQuorumNotReached)
+	}
+
+	if !results[0].Accepted() {
+		t.Errorf("Options client should be accepted : %v", results[0].Err)
+	}
+
+	if errors.Cause(results[1].Err) != ErrOptionsNotSupported {
+		t.Errorf("Wrong error : got %v, want %s", results[1].Err, ErrOptionsNotSupported)
+	}
+}
+
+func Test_MultiClient_TxFormat(t *testing.T) {
+	bodies := make(chan []byte, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- body
+		w.Write([]byte(`{"txStatus":"STORED"}`))
+	}))
+	defer server.Close()
+
+	clients := []Client{
+		NewHTTPClient(server.URL, "", "", DefaultConfig()),
+		NewHTTPClient(server.URL, "", "", DefaultConfig()),
+	}
+
+	// Without spent outputs, ancestors, or merkle proofs the tx can only be submitted raw.
+	etx := txtest.NewExpandedTx(1, 9990)
+	etx.Ancestors = nil
+
+	if _, err := NewMultiClient(clients, 2).SubmitTxWithOptions(context.Background(), etx,
+		SubmitOptions{TxFormat: TxFormatBEEF}); err != nil {
+		t.Fatalf("Failed to submit : %s", err)
+	}
+
+	raw := &bytes.Buffer{}
+	etx.Tx.Serialize(raw)
+
+	for range clients {
+		if body := <-bodies; !bytes.Equal(body, raw.Bytes()) {
+			t.Fatalf("Wrong raw body : \n   got %x\n  want %x", body, raw.Bytes())
+		}
+	}
+}
+
+var (
+	_ OptionsClient = (*HTTPClient)(nil)
+	_ OptionsClient = (*MultiClient)(nil)
+	_ OptionsClient = (*FailoverClient)(nil)
+)
@@ -0,0 +1,509 @@
+package beef
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/tokenized/arc/pkg/bump"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+	"github.com/tokenized/pkg/merkle_proof"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+// BRC-62 Background Evaluation Extended Format https://bsv.brc.dev/transactions/0062
+// BRC-95 Atomic BEEF https://bsv.brc.dev/transactions/0095
+
+const (
+	// VersionV1 is the version of BRC-62 BEEF. It is serialized as 0100beef.
+	VersionV1 = uint32(0xefbe0001)
+
+	// AtomicPrefix is the prefix of BRC-95 atomic BEEF. It is followed by the txid of the subject
+	// tx and then the BEEF.
+	AtomicPrefix = uint32(0x01010101)
+
+	txProtocolVersion = uint32(0)
+
+	// maxCount limits the capacity allocated for counts before the items are read.
+	maxCount = 1024
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("Unsupported BEEF Version")
+	ErrMissingAncestor    = errors.New("Missing Ancestor")
+	ErrMissingBlockHash   = errors.New("Missing Block Hash")
+	ErrBlockNotFound      = errors.New("Block Not Found")
+	ErrInvalidBUMPIndex   = errors.New("Invalid BUMP Index")
+	ErrInvalidBUMPFlag    = errors.New("Invalid BUMP Flag")
+	ErrWrongSubject       = errors.New("Wrong Atomic BEEF Subject")
+	ErrNoTxs              = errors.New("No Txs")
+
+	endian = binary.LittleEndian
+)
+
+// Beef is a tx with its unmined ancestors and the BRC-74 merkle paths (BUMPs) of its mined
+// ancestors. The txs are in dependency order so parents are before the txs that spend them. The
+// last tx is the subject tx.
+type Beef struct {
+	// AtomicTxID is the txid of the subject tx when the BEEF is atomic.
+	AtomicTxID *bitcoin.Hash32
+
+	BUMPs []*bump.MerklePath
+	Txs   []*Tx
+}
+
+// Tx is a tx in a BEEF.
+type Tx struct {
+	Tx *wire.MsgTx
+
+	// BUMP is the merkle path of the tx. It is nil when the tx isn't mined. It must be one of the
+	// BUMPs of the BEEF.
+	BUMP *bump.MerklePath
+}
+
+// BlockHeights provides the heights of blocks. Merkle proofs don't contain the block height, but
+// BUMPs do.
+type BlockHeights interface {
+	// BlockHeight returns the height of the block with the hash. It returns ErrBlockNotFound when
+	// the block isn't known.
+	BlockHeight(blockHash bitcoin.Hash32) (uint64, error)
+}
+
+// BlockHeightMap is BlockHeights from a map of block hashes to heights.
+type BlockHeightMap map[bitcoin.Hash32]uint64
+
+func (m BlockHeightMap) BlockHeight(blockHash bitcoin.Hash32) (uint64, error) {
+	height, exists := m[blockHash]
+	if !exists {
+		return 0, errors.Wrap(ErrBlockNotFound, blockHash.String())
+	}
+
+	return height, nil
+}
+
+// Serialize writes the expanded tx as BEEF. See NewBeef.
+func Serialize(w io.Writer, etx *expanded_tx.ExpandedTx, heights BlockHeights) error {
+	beef, err := NewBeef(etx, heights)
+	if err != nil {
+		return err
+	}
+
+	return beef.Serialize(w)
+}
+
+// SerializeAtomic writes the expanded tx as atomic BEEF. See NewBeef.
+func SerializeAtomic(w io.Writer, etx *expanded_tx.ExpandedTx, heights BlockHeights) error {
+	beef, err := NewAtomicBeef(etx, heights)
+	if err != nil {
+		return err
+	}
+
+	return beef.Serialize(w)
+}
+
+// Deserialize reads BEEF, or atomic BEEF, and returns the subject tx as an expanded tx. See
+// Beef.ExpandedTx.
+func Deserialize(r io.Reader) (*expanded_tx.ExpandedTx, error) {
+	beef := &Beef{}
+	if err := beef.Deserialize(r); err != nil {
+		return nil, err
+	}
+
+	return beef.ExpandedTx()
+}
+
+// IsBEEF returns true if the bytes start with the BEEF version or the atomic BEEF prefix.
+func IsBEEF(b []byte) bool {
+	if len(b) < 4 {
+		return false
+	}
+
+	version := endian.Uint32(b)
+	return version == VersionV1 || version == AtomicPrefix
+}
+
+// NewBeef creates a BEEF from the expanded tx. Ancestors with merkle proofs are included with
+// their BUMPs and their own ancestors are not needed. Ancestors without merkle proofs are included
+// with their ancestors. When the tx itself has a merkle proof no ancestors are included. The
+// heights are used to convert the merkle proofs to BUMPs.
+func NewBeef(etx *expanded_tx.ExpandedTx, heights BlockHeights) (*Beef, error) {
+	if etx.Tx == nil {
+		return nil, ErrNoTxs
+	}
+
+	b := &beefBuilder{
+		etx:     etx,
+		heights: heights,
+		result:  &Beef{},
+		added:   make(map[bitcoin.Hash32]bool),
+		bumps:   make(map[uint64][]*bump.MerklePath),
+	}
+
+	subject := &Tx{Tx: etx.Tx}
+	if len(etx.MerkleProofs) > 0 {
+		merklePath, err := b.bump(*etx.Tx.TxHash(), etx.MerkleProofs[0])
+		if err != nil {
+			return nil, errors.Wrap(err, "merkle proof")
+		}
+		subject.BUMP = merklePath
+	} else if err := b.addParents(etx.Tx); err != nil {
+		return nil, err
+	}
+	b.result.Txs = append(b.result.Txs, subject)
+
+	return b.result, nil
+}
+
+// NewAtomicBeef creates an atomic BEEF from the expanded tx. See NewBeef.
+func NewAtomicBeef(etx *expanded_tx.ExpandedTx, heights BlockHeights) (*Beef, error) {
+	result, err := NewBeef(etx, heights)
+	if err != nil {
+		return nil, err
+	}
+
+	txid := *etx.Tx.TxHash()
+	result.AtomicTxID = &txid
+	return result, nil
+}
+
+type beefBuilder struct {
+	etx     *expanded_tx.ExpandedTx
+	heights BlockHeights
+	result  *Beef
+	added   map[bitcoin.Hash32]bool
+	bumps   map[uint64][]*bump.MerklePath // by block height
+}
+
+// addParents adds the ancestors that the tx spends, and their ancestors, to the result. Parents
+// are added before the txs that spend them.
+func (b *beefBuilder) addParents(tx *wire.MsgTx) error {
+	for index, input := range tx.TxIn {
+		parentTxID := input.PreviousOutPoint.Hash
+		if b.added[parentTxID] {
+			continue
+		}
+
+		ancestor := b.etx.Ancestors.GetTx(parentTxID)
+		if ancestor == nil || ancestor.Tx == nil {
+			return errors.Wrapf(ErrMissingAncestor, "input %d: %s", index,
+				input.PreviousOutPoint)
+		}
+		b.added[parentTxID] = true
+
+		parent := &Tx{Tx: ancestor.Tx}
+		if len(ancestor.MerkleProofs) > 0 {
+			merklePath, err := b.bump(parentTxID, ancestor.MerkleProofs[0])
+			if err != nil {
+				return errors.Wrapf(err, "merkle proof %s", parentTxID)
+			}
+			parent.BUMP = merklePath
+		} else if err := b.addParents(ancestor.Tx); err != nil {
+			return errors.Wrapf(err, "ancestor %s", parentTxID)
+		}
+
+		b.result.Txs = append(b.result.Txs, parent)
+	}
+
+	return nil
+}
+
+// bump converts the merkle proof to a BUMP. When there is already a BUMP for the same block the
+// merkle proof is combined into it.
+func (b *beefBuilder) bump(txid bitcoin.Hash32,
+	merkleProof *merkle_proof.MerkleProof) (*bump.MerklePath, error) {
+
+	proof := *merkleProof
+	if proof.GetTxID() == nil {
+		proof.TxID = &txid
+	}
+
+	blockHash := proof.GetBlockHash()
+	if blockHash == nil {
+		return nil, ErrMissingBlockHash
+	}
+
+	if b.heights == nil {
+		return nil, errors.Wrap(ErrBlockNotFound, "no block heights")
+	}
+
+	height, err := b.heights.BlockHeight(*blockHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "block height")
+	}
+
+	merklePath, err := bump.NewMerklePathFromProof(height, &proof)
+	if err != nil {
+		return nil, errors.Wrap(err, "merkle path")
+	}
+
+	for _, existing := range b.bumps[height] {
+		if err := existing.Combine(*merklePath); err == nil {
+			return existing, nil
+		}
+	}
+
+	b.bumps[height] = append(b.bumps[height], merklePath)
+	b.result.BUMPs = append(b.result.BUMPs, merklePath)
+	return merklePath, nil
+}
+
+// Subject returns the tx that the BEEF is for.
+func (b Beef) Subject() *Tx {
+	if len(b.Txs) == 0 {
+		return nil
+	}
+
+	return b.Txs[len(b.Txs)-1]
+}
+
+// ExpandedTx returns the subject tx as an expanded tx with the other txs as ancestors. The merkle
+// proofs converted from the BUMPs contain the merkle root, but not the block hash because it isn't
+// in the BEEF.
+func (b Beef) ExpandedTx() (*expanded_tx.ExpandedTx, error) {
+	subject := b.Subject()
+	if subject == nil {
+		return nil, ErrNoTxs
+	}
+
+	result := &expanded_tx.ExpandedTx{
+		Tx: subject.Tx,
+	}
+
+	if subject.BUMP != nil {
+		merkleProof, err := newMerkleProof(subject)
+		if err != nil {
+			return nil, errors.Wrap(err, "subject")
+		}
+		result.MerkleProofs = merkle_proof.MerkleProofs{merkleProof}
+	}
+
+	for _, tx := range b.Txs[:len(b.Txs)-1] {
+		ancestor := &expanded_tx.AncestorTx{
+			Tx: tx.Tx,
+		}
+
+		if tx.BUMP != nil {
+			merkleProof, err := newMerkleProof(tx)
+			if err != nil {
+				return nil, errors.Wrapf(err, "ancestor %s", tx.Tx.TxHash())
+			}
+			ancestor.MerkleProofs = merkle_proof.MerkleProofs{merkleProof}
+		}
+
+		result.Ancestors = append(result.Ancestors, ancestor)
+	}
+
+	return result, nil
+}
+
+func newMerkleProof(tx *Tx) (*merkle_proof.MerkleProof, error) {
+	txid := *tx.Tx.TxHash()
+	result, err := tx.BUMP.MerkleProof(txid)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := tx.BUMP.ComputeRoot(txid)
+	if err != nil {
+		return nil, err
+	}
+	result.MerkleRoot = &root
+
+	return result, nil
+}
+
+// Bytes returns the serialized BEEF.
+func (b Beef) Bytes() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := b.Serialize(buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (b Beef) Serialize(w io.Writer) error {
+	if b.AtomicTxID != nil {
+		if err := binary.Write(w, endian, AtomicPrefix); err != nil {
+			return errors.Wrap(err, "atomic prefix")
+		}
+
+		if err := b.AtomicTxID.Serialize(w); err != nil {
+			return errors.Wrap(err, "atomic txid")
+		}
+	}
+
+	if err := binary.Write(w, endian, VersionV1); err != nil {
+		return errors.Wrap(err, "version")
+	}
+
+	if err := wire.WriteVarInt(w, txProtocolVersion, uint64(len(b.BUMPs))); err != nil {
+		return errors.Wrap(err, "bump count")
+	}
+
+	bumpIndexes := make(map[*bump.MerklePath]uint64)
+	for index, merklePath := range b.BUMPs {
+		if err := merklePath.Serialize(w); err != nil {
+			return errors.Wrapf(err, "bump %d", index)
+		}
+		bumpIndexes[merklePath] = uint64(index)
+	}
+
+	if err := wire.WriteVarInt(w, txProtocolVersion, uint64(len(b.Txs))); err != nil {
+		return errors.Wrap(err, "tx count")
+	}
+
+	for index, tx := range b.Txs {
+		if err := tx.serialize(w, bumpIndexes); err != nil {
+			return errors.Wrapf(err, "tx %d", index)
+		}
+	}
+
+	return nil
+}
+
+func (tx Tx) serialize(w io.Writer, bumpIndexes map[*bump.MerklePath]uint64) error {
+	if err := tx.Tx.Serialize(w); err != nil {
+		return errors.Wrap(err, "tx")
+	}
+
+	if tx.BUMP == nil {
+		if _, err := w.Write([]byte{0x00}); err != nil {
+			return errors.Wrap(err, "has bump")
+		}
+
+		return nil
+	}
+
+	bumpIndex, exists := bumpIndexes[tx.BUMP]
+	if !exists {
+		return errors.Wrap(ErrInvalidBUMPIndex, "bump not in beef")
+	}
+
+	if _, err := w.Write([]byte{0x01}); err != nil {
+		return errors.Wrap(err, "has bump")
+	}
+
+	if err := wire.WriteVarInt(w, txProtocolVersion, bumpIndex); err != nil {
+		return errors.Wrap(err, "bump index")
+	}
+
+	return nil
+}
+
+func (b *Beef) Deserialize(r io.Reader) error {
+	*b = Beef{}
+
+	var version uint32
+	if err := binary.Read(r, endian, &version); err != nil {
+		return errors.Wrap(err, "version")
+	}
+
+	if version == AtomicPrefix {
+		txid := &bitcoin.Hash32{}
+		if err := txid.Deserialize(r); err != nil {
+			return errors.Wrap(err, "atomic txid")
+		}
+		b.AtomicTxID = txid
+
+		if err := binary.Read(r, endian, &version); err != nil {
+			return errors.Wrap(err, "version")
+		}
+	}
+
+	if version != VersionV1 {
+		return errors.Wrapf(ErrUnsupportedVersion, "%08x", version)
+	}
+
+	bumpCount, err := wire.ReadVarInt(r, txProtocolVersion)
+	if err != nil {
+		return errors.Wrap(err, "bump count")
+	}
+
+	b.BUMPs = make([]*bump.MerklePath, 0, capacity(bumpCount))
+	for index := uint64(0); index < bumpCount; index++ {
+		merklePath := &bump.MerklePath{}
+		if err := merklePath.Deserialize(r); err != nil {
+			return errors.Wrapf(err, "bump %d", index)
+		}
+
+		b.BUMPs = append(b.BUMPs, merklePath)
+	}
+
+	txCount, err := wire.ReadVarInt(r, txProtocolVersion)
+	if err != nil {
+		return errors.Wrap(err, "tx count")
+	}
+
+	if txCount == 0 {
+		return ErrNoTxs
+	}
+
+	b.Txs = make([]*Tx, 0, capacity(txCount))
+	for index := uint64(0); index < txCount; index++ {
+		tx := &Tx{}
+		if err := tx.deserialize(r, b.BUMPs); err != nil {
+			return errors.Wrapf(err, "tx %d", index)
+		}
+
+		b.Txs = append(b.Txs, tx)
+	}
+
+	if b.AtomicTxID != nil {
+		subjectTxID := b.Subject().Tx.TxHash()
+		if !subjectTxID.Equal(b.AtomicTxID) {
+			return errors.Wrapf(ErrWrongSubject, "got %s, want %s", subjectTxID, b.AtomicTxID)
+		}
+	}
+
+	return nil
+}
+
+func (tx *Tx) deserialize(r io.Reader, bumps []*bump.MerklePath) error {
+	msgTx := &wire.MsgTx{}
+	if err := msgTx.Deserialize(r); err != nil {
+		return errors.Wrap(err, "tx")
+	}
+	tx.Tx = msgTx
+
+	var hasBUMP [1]byte
+	if _, err := io.ReadFull(r, hasBUMP[:]); err != nil {
+		return errors.Wrap(err, "has bump")
+	}
+
+	switch hasBUMP[0] {
+	case 0x00:
+		return nil
+	case 0x01:
+	default:
+		return errors.Wrapf(ErrInvalidBUMPFlag, "%02x", hasBUMP[0])
+	}
+
+	bumpIndex, err := wire.ReadVarInt(r, txProtocolVersion)
+	if err != nil {
+		return errors.Wrap(err, "bump index")
+	}
+
+	if bumpIndex >= uint64(len(bumps)) {
+		return errors.Wrapf(ErrInvalidBUMPIndex, "index %d, %d bumps", bumpIndex, len(bumps))
+	}
+
+	tx.BUMP = bumps[bumpIndex]
+	txid := *msgTx.TxHash()
+	if !tx.BUMP.Contains(txid) {
+		return errors.Wrapf(bump.ErrTxNotFound, "bump %d: %s", bumpIndex, txid)
+	}
+
+	return nil
+}
+
+func capacity(count uint64) uint64 {
+	if count > maxCount {
+		return maxCount
+	}
+
+	return count
+}
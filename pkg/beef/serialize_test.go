@@ -0,0 +1,328 @@
+package beef
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/tokenized/arc/internal/txtest"
+	"github.com/tokenized/arc/pkg/bump"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+	"github.com/tokenized/pkg/merkle_proof"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+// testMine puts the txs in a block with some other txs and returns their merkle proofs.
+func testMine(t *testing.T, heights BlockHeightMap, height uint64,
+	txs ...*wire.MsgTx) []*merkle_proof.MerkleProof {
+
+	var blockHash bitcoin.Hash32
+	rand.Read(blockHash[:])
+	heights[blockHash] = height
+
+	txids := make([]bitcoin.Hash32, 5)
+	for i := range txids {
+		rand.Read(txids[i][:])
+	}
+	for i, tx := range txs {
+		txids[i+1] = *tx.TxHash()
+	}
+
+	var result []*merkle_proof.MerkleProof
+	for i := range txs {
+		path, err := bump.NewMerklePath(height, txids, i+1)
+		if err != nil {
+			t.Fatalf("Failed to create merkle path : %s", err)
+		}
+
+		proof, err := path.MerkleProof(txids[i+1])
+		if err != nil {
+			t.Fatalf("Failed to create merkle proof : %s", err)
+		}
+		proof.BlockHash = &blockHash
+
+		result = append(result, proof)
+	}
+
+	return result
+}
+
+func Test_Serialize_WithMinedParents(t *testing.T) {
+	heights := make(BlockHeightMap)
+
+	parent1 := txtest.NewTx(nil, 10000)
+	parent2 := txtest.NewTx(nil, 10000)
+	parent3 := txtest.NewTx(nil, 10000)
+	sameBlockProofs := testMine(t, heights, 1000, parent1, parent2)
+	otherBlockProofs := testMine(t, heights, 1001, parent3)
+
+	tx := txtest.NewTx([]*wire.MsgTx{parent1, parent2, parent3}, 10000)
+	txid := *tx.TxHash()
+	etx := &expanded_tx.ExpandedTx{
+		Tx: tx,
+		Ancestors: expanded_tx.AncestorTxs{
+			{
+				Tx:           parent1,
+				MerkleProofs: merkle_proof.MerkleProofs{sameBlockProofs[0]},
+			},
+			{
+				Tx:           parent2,
+				MerkleProofs: merkle_proof.MerkleProofs{sameBlockProofs[1]},
+			},
+			{
+				Tx:           parent3,
+				MerkleProofs: merkle_proof.MerkleProofs{otherBlockProofs[0]},
+			},
+		},
+	}
+
+	beef, err := NewBeef(etx, heights)
+	if err != nil {
+		t.Fatalf("Failed to create beef : %s", err)
+	}
+
+	if len(beef.BUMPs) != 2 {
+		t.Fatalf("Wrong bump count : got %d, want %d", len(beef.BUMPs), 2)
+	}
+
+	if len(beef.Txs) != 4 {
+		t.Fatalf("Wrong tx count : got %d, want %d", len(beef.Txs), 4)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Serialize(buf, etx, heights); err != nil {
+		t.Fatalf("Failed to serialize beef : %s", err)
+	}
+
+	beefBytes := buf.Bytes()
+	t.Logf("BEEF bytes : %x", beefBytes)
+
+	if !IsBEEF(beefBytes) {
+		t.Fatalf("Serialized bytes should be BEEF")
+	}
+
+	detx, err := Deserialize(bytes.NewReader(beefBytes))
+	if err != nil {
+		t.Fatalf("Failed to deserialize beef : %s", err)
+	}
+
+	detxid := detx.TxID()
+	if !detxid.Equal(&txid) {
+		t.Fatalf("Wrong deserialized txid : \n   got %s\n  want %s", detxid, txid)
+	}
+
+	if len(detx.Ancestors) != 3 {
+		t.Fatalf("Wrong deserialized ancestor count : got %d, want %d", len(detx.Ancestors), 3)
+	}
+
+	for _, ancestor := range detx.Ancestors {
+		if len(ancestor.MerkleProofs) != 1 {
+			t.Fatalf("Wrong ancestor merkle proof count : got %d, want %d",
+				len(ancestor.MerkleProofs), 1)
+		}
+
+		if err := ancestor.MerkleProofs[0].Verify(); err != nil {
+			t.Fatalf("Failed to verify ancestor merkle proof : %s", err)
+		}
+	}
+
+	for index := 0; index < detx.InputCount(); index++ {
+		if _, err := detx.InputOutput(index); err != nil {
+			t.Fatalf("Failed to get input output %d : %s", index, err)
+		}
+	}
+
+	// Round trip the BEEF without converting to an expanded tx.
+	dbeef := &Beef{}
+	if err := dbeef.Deserialize(bytes.NewReader(beefBytes)); err != nil {
+		t.Fatalf("Failed to deserialize beef : %s", err)
+	}
+
+	reserialized, err := dbeef.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to serialize beef : %s", err)
+	}
+
+	if !bytes.Equal(reserialized, beefBytes) {
+		t.Fatalf("Wrong reserialized beef : \n   got %x\n  want %x", reserialized, beefBytes)
+	}
+}
+
+func Test_Serialize_WithUnminedParent(t *testing.T) {
+	heights := make(BlockHeightMap)
+
+	grandParent := txtest.NewTx(nil, 10000)
+	proofs := testMine(t, heights, 1000, grandParent)
+	parent := txtest.NewTx([]*wire.MsgTx{grandParent}, 10000)
+	tx := txtest.NewTx([]*wire.MsgTx{parent}, 10000)
+
+	etx := &expanded_tx.ExpandedTx{
+		Tx: tx,
+		Ancestors: expanded_tx.AncestorTxs{
+			{
+				Tx: parent,
+			},
+			{
+				Tx:           grandParent,
+				MerkleProofs: merkle_proof.MerkleProofs{proofs[0]},
+			},
+		},
+	}
+
+	beef, err := NewBeef(etx, heights)
+	if err != nil {
+		t.Fatalf("Failed to create beef : %s", err)
+	}
+
+	wantTxIDs := []bitcoin.Hash32{*grandParent.TxHash(), *parent.TxHash(), *tx.TxHash()}
+	if len(beef.Txs) != len(wantTxIDs) {
+		t.Fatalf("Wrong tx count : got %d, want %d", len(beef.Txs), len(wantTxIDs))
+	}
+
+	for i, wantTxID := range wantTxIDs {
+		if txid := beef.Txs[i].Tx.TxHash(); !txid.Equal(&wantTxID) {
+			t.Fatalf("Wrong tx %d : got %s, want %s", i, txid, wantTxID)
+		}
+	}
+
+	if beef.Txs[0].BUMP == nil || beef.Txs[1].BUMP != nil || beef.Txs[2].BUMP != nil {
+		t.Fatalf("Only the grand parent should have a bump")
+	}
+
+	beefBytes, err := beef.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to serialize beef : %s", err)
+	}
+	t.Logf("BEEF bytes : %x", beefBytes)
+
+	detx, err := Deserialize(bytes.NewReader(beefBytes))
+	if err != nil {
+		t.Fatalf("Failed to deserialize beef : %s", err)
+	}
+
+	if err := detx.VerifyAncestors(); err != nil {
+		t.Fatalf("Failed to verify ancestors : %s", err)
+	}
+}
+
+func Test_Serialize_Atomic(t *testing.T) {
+	heights := make(BlockHeightMap)
+
+	parent := txtest.NewTx(nil, 10000)
+	proofs := testMine(t, heights, 1000, parent)
+	tx := txtest.NewTx([]*wire.MsgTx{parent}, 10000)
+	txid := *tx.TxHash()
+
+	etx := &expanded_tx.ExpandedTx{
+		Tx: tx,
+		Ancestors: expanded_tx.AncestorTxs{
+			{
+				Tx:           parent,
+				MerkleProofs: merkle_proof.MerkleProofs{proofs[0]},
+			},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := SerializeAtomic(buf, etx, heights); err != nil {
+		t.Fatalf("Failed to serialize atomic beef : %s", err)
+	}
+
+	beefBytes := buf.Bytes()
+	t.Logf("Atomic BEEF bytes : %x", beefBytes)
+
+	if !IsBEEF(beefBytes) {
+		t.Fatalf("Serialized bytes should be BEEF")
+	}
+
+	beef := &Beef{}
+	if err := beef.Deserialize(bytes.NewReader(beefBytes)); err != nil {
+		t.Fatalf("Failed to deserialize atomic beef : %s", err)
+	}
+
+	if beef.AtomicTxID == nil || !beef.AtomicTxID.Equal(&txid) {
+		t.Fatalf("Wrong atomic txid : got %v, want %s", beef.AtomicTxID, txid)
+	}
+
+	// Change the subject txid.
+	wrongBytes := make([]byte, len(beefBytes))
+	copy(wrongBytes, beefBytes)
+	wrongBytes[4] ^= 0xff
+
+	err := beef.Deserialize(bytes.NewReader(wrongBytes))
+	if !errors.Is(err, ErrWrongSubject) {
+		t.Fatalf("Wrong subject error : got %v, want %s", err, ErrWrongSubject)
+	}
+}
+
+func Test_Serialize_Errors(t *testing.T) {
+	heights := make(BlockHeightMap)
+
+	parent := txtest.NewTx(nil, 10000)
+	proofs := testMine(t, heights, 1000, parent)
+	tx := txtest.NewTx([]*wire.MsgTx{parent}, 10000)
+
+	if _, err := NewBeef(&expanded_tx.ExpandedTx{
+		Tx: tx,
+	}, heights); !errors.Is(err, ErrMissingAncestor) {
+		t.Fatalf("Wrong missing ancestor error : got %v, want %s", err, ErrMissingAncestor)
+	}
+
+	etx := &expanded_tx.ExpandedTx{
+		Tx: tx,
+		Ancestors: expanded_tx.AncestorTxs{
+			{
+				Tx:           parent,
+				MerkleProofs: merkle_proof.MerkleProofs{proofs[0]},
+			},
+		},
+	}
+
+	if _, err := NewBeef(etx, make(BlockHeightMap)); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("Wrong block height error : got %v, want %s", err, ErrBlockNotFound)
+	}
+
+	beefBytes, err := (&Beef{Txs: []*Tx{{Tx: tx}}}).Bytes()
+	if err != nil {
+		t.Fatalf("Failed to serialize beef : %s", err)
+	}
+
+	beefBytes[len(beefBytes)-1] = 0x02 // has bump flag
+	if _, err := Deserialize(bytes.NewReader(beefBytes)); !errors.Is(err, ErrInvalidBUMPFlag) {
+		t.Fatalf("Wrong bump flag error : got %v, want %s", err, ErrInvalidBUMPFlag)
+	}
+
+	beefBytes[0] = 0x02 // BEEF V2
+	if _, err := Deserialize(bytes.NewReader(beefBytes)); !errors.Is(err,
+		ErrUnsupportedVersion) {
+		t.Fatalf("Wrong version error : got %v, want %s", err, ErrUnsupportedVersion)
+	}
+}
+
+func Test_Serialize_MinedSubject(t *testing.T) {
+	heights := make(BlockHeightMap)
+
+	parent := txtest.NewTx(nil, 10000)
+	tx := txtest.NewTx([]*wire.MsgTx{parent}, 10000)
+	proofs := testMine(t, heights, 1000, tx)
+
+	// The parent isn't needed because the tx has a merkle proof.
+	beef, err := NewBeef(&expanded_tx.ExpandedTx{
+		Tx:           tx,
+		MerkleProofs: merkle_proof.MerkleProofs{proofs[0]},
+	}, heights)
+	if err != nil {
+		t.Fatalf("Failed to create beef : %s", err)
+	}
+
+	if len(beef.Txs) != 1 {
+		t.Fatalf("Wrong tx count : got %d, want %d", len(beef.Txs), 1)
+	}
+
+	if beef.Txs[0].BUMP == nil {
+		t.Fatalf("Missing subject bump")
+	}
+}
@@ -0,0 +1,702 @@
+package bump
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/merkle_proof"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+// BSV Unified Merkle Path (BUMP) https://bsv.brc.dev/transactions/0074
+
+const (
+	// FlagDuplicate marks a leaf that is a duplicate of its sibling, so it has no hash.
+	FlagDuplicate = byte(0x01)
+
+	// FlagTxID marks a leaf that is the txid of a tx the path is for.
+	FlagTxID = byte(0x02)
+
+	// MaxTreeHeight is the maximum number of levels in a merkle path.
+	MaxTreeHeight = 64
+
+	txProtocolVersion = uint32(0)
+)
+
+var (
+	ErrTxNotFound     = errors.New("Tx Not In Merkle Path")
+	ErrMissingHash    = errors.New("Missing Merkle Path Hash")
+	ErrInvalidFlags   = errors.New("Invalid Merkle Path Flags")
+	ErrInvalidHeight  = errors.New("Invalid Merkle Path Tree Height")
+	ErrDifferentBlock = errors.New("Merkle Paths For Different Blocks")
+)
+
+// MerklePath is a BRC-74 merkle path. It proves that one or more txs are in the block at
+// BlockHeight.
+type MerklePath struct {
+	BlockHeight uint64
+
+	// Path contains the leaves for each level of the merkle tree starting from the txid level.
+	Path [][]*Leaf
+}
+
+// Leaf is a node of the merkle tree included in a merkle path.
+type Leaf struct {
+	Offset    uint64          // position of the node in its level of the tree
+	Hash      *bitcoin.Hash32 // nil when the leaf is a duplicate
+	TxID      bool            // the leaf is a txid the path is for
+	Duplicate bool            // the leaf is a duplicate of its sibling
+}
+
+// NewMerklePath creates the merkle path for the tx at the index from all of the txids in the block.
+func NewMerklePath(blockHeight uint64, txids []bitcoin.Hash32, index int) (*MerklePath, error) {
+	if index < 0 || index >= len(txids) {
+		return nil, fmt.Errorf("index %d out of range of %d txs", index, len(txids))
+	}
+
+	levels := merkleLevels(txids)
+	result := &MerklePath{
+		BlockHeight: blockHeight,
+		Path:        make([][]*Leaf, len(levels)-1),
+	}
+
+	if len(result.Path) == 0 {
+		// The tx is the only tx in the block.
+		txid := txids[index]
+		result.Path = [][]*Leaf{{{Offset: 0, Hash: &txid, TxID: true}}}
+		return result, nil
+	}
+
+	offset := uint64(index)
+	for level := range result.Path {
+		nodes := levels[level]
+		siblingOffset := offset ^ 1
+
+		sibling := &Leaf{
+			Offset: siblingOffset,
+		}
+		if siblingOffset < uint64(len(nodes)) {
+			hash := nodes[siblingOffset]
+			sibling.Hash = &hash
+		} else {
+			sibling.Duplicate = true
+		}
+
+		if level == 0 {
+			txid := nodes[offset]
+			txLeaf := &Leaf{
+				Offset: offset,
+				Hash:   &txid,
+				TxID:   true,
+			}
+
+			if offset < siblingOffset {
+				result.Path[level] = []*Leaf{txLeaf, sibling}
+			} else {
+				result.Path[level] = []*Leaf{sibling, txLeaf}
+			}
+		} else {
+			result.Path[level] = []*Leaf{sibling}
+		}
+
+		offset /= 2
+	}
+
+	return result, nil
+}
+
+// NewMerklePathFromProof converts a merkle proof to a merkle path for the block at the height.
+func NewMerklePathFromProof(blockHeight uint64,
+	proof *merkle_proof.MerkleProof) (*MerklePath, error) {
+
+	txid := proof.GetTxID()
+	if txid == nil {
+		return nil, merkle_proof.ErrMissingTxID
+	}
+
+	if proof.Index < 0 {
+		return nil, errors.Wrapf(merkle_proof.ErrBadIndex, "index %d", proof.Index)
+	}
+
+	offset := uint64(proof.Index)
+	txLeaf := &Leaf{
+		Offset: offset,
+		Hash:   txid,
+		TxID:   true,
+	}
+
+	depth := len(proof.Path) + len(proof.DuplicatedIndexes)
+	if depth == 0 {
+		if offset != 0 {
+			return nil, errors.Wrapf(merkle_proof.ErrBadIndex, "index %d", proof.Index)
+		}
+
+		// The tx is the only tx in the block.
+		return &MerklePath{
+			BlockHeight: blockHeight,
+			Path:        [][]*Leaf{{txLeaf}},
+		}, nil
+	}
+
+	result := &MerklePath{
+		BlockHeight: blockHeight,
+		Path:        make([][]*Leaf, depth),
+	}
+
+	path := proof.Path
+	duplicates := proof.DuplicatedIndexes
+	for level := range result.Path {
+		sibling := &Leaf{
+			Offset: offset ^ 1,
+		}
+
+		// Merkle proof duplicate indexes are the 1 based layer.
+		if len(duplicates) > 0 && duplicates[0] == level+1 {
+			if offset%2 == 1 {
+				return nil, errors.Wrapf(merkle_proof.ErrBadIndex,
+					"right node duplicated at level %d", level)
+			}
+
+			sibling.Duplicate = true
+			duplicates = duplicates[1:]
+		} else {
+			if len(path) == 0 {
+				return nil, fmt.Errorf("duplicate layer %d out of order", duplicates[0])
+			}
+
+			hash := path[0]
+			sibling.Hash = &hash
+			path = path[1:]
+		}
+
+		if level == 0 {
+			if txLeaf.Offset < sibling.Offset {
+				result.Path[level] = []*Leaf{txLeaf, sibling}
+			} else {
+				result.Path[level] = []*Leaf{sibling, txLeaf}
+			}
+		} else {
+			result.Path[level] = []*Leaf{sibling}
+		}
+
+		offset /= 2
+	}
+
+	if len(duplicates) > 0 {
+		return nil, fmt.Errorf("duplicate layer %d out of range", duplicates[0])
+	}
+
+	if offset != 0 {
+		return nil, errors.Wrapf(merkle_proof.ErrBadIndex, "index %d beyond depth %d",
+			proof.Index, depth)
+	}
+
+	return result, nil
+}
+
+// MerkleRoot calculates the merkle root of the txids.
+func MerkleRoot(txids []bitcoin.Hash32) bitcoin.Hash32 {
+	if len(txids) == 0 {
+		return bitcoin.Hash32{}
+	}
+
+	levels := merkleLevels(txids)
+	return levels[len(levels)-1][0]
+}
+
+// merkleLevels returns the levels of the merkle tree from the txids up to the root.
+func merkleLevels(txids []bitcoin.Hash32) [][]bitcoin.Hash32 {
+	levels := [][]bitcoin.Hash32{txids}
+	level := txids
+	for len(level) > 1 {
+		var next []bitcoin.Hash32
+		for i := 0; i < len(level); i += 2 {
+			left := level[i]
+			right := left
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+
+			next = append(next, hashPair(left, right))
+		}
+
+		levels = append(levels, next)
+		level = next
+	}
+
+	return levels
+}
+
+// ParseHex decodes a merkle path from hex, like the merklePath field of ARC responses.
+func ParseHex(s string) (*MerklePath, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "hex")
+	}
+
+	return Parse(b)
+}
+
+// Parse decodes a merkle path from bytes. All bytes must be used.
+func Parse(b []byte) (*MerklePath, error) {
+	r := bytes.NewReader(b)
+	result := &MerklePath{}
+	if err := result.Deserialize(r); err != nil {
+		return nil, err
+	}
+
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d extra bytes after merkle path", r.Len())
+	}
+
+	return result, nil
+}
+
+func (p MerklePath) Serialize(w io.Writer) error {
+	if len(p.Path) > MaxTreeHeight {
+		return errors.Wrapf(ErrInvalidHeight, "%d", len(p.Path))
+	}
+
+	if err := wire.WriteVarInt(w, txProtocolVersion, p.BlockHeight); err != nil {
+		return errors.Wrap(err, "block height")
+	}
+
+	if _, err := w.Write([]byte{byte(len(p.Path))}); err != nil {
+		return errors.Wrap(err, "tree height")
+	}
+
+	for level, leaves := range p.Path {
+		if err := wire.WriteVarInt(w, txProtocolVersion, uint64(len(leaves))); err != nil {
+			return errors.Wrapf(err, "level %d leaf count", level)
+		}
+
+		for i, leaf := range leaves {
+			if err := leaf.Serialize(w); err != nil {
+				return errors.Wrapf(err, "level %d leaf %d", level, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *MerklePath) Deserialize(r io.Reader) error {
+	blockHeight, err := wire.ReadVarInt(r, txProtocolVersion)
+	if err != nil {
+		return errors.Wrap(err, "block height")
+	}
+	p.BlockHeight = blockHeight
+
+	var treeHeight [1]byte
+	if _, err := io.ReadFull(r, treeHeight[:]); err != nil {
+		return errors.Wrap(err, "tree height")
+	}
+
+	if treeHeight[0] > MaxTreeHeight {
+		return errors.Wrapf(ErrInvalidHeight, "%d", treeHeight[0])
+	}
+
+	p.Path = make([][]*Leaf, treeHeight[0])
+	for level := range p.Path {
+		count, err := wire.ReadVarInt(r, txProtocolVersion)
+		if err != nil {
+			return errors.Wrapf(err, "level %d leaf count", level)
+		}
+
+		// Don't trust the count for the allocation. Reading fails when the data runs out.
+		capacity := count
+		if capacity > 1024 {
+			capacity = 1024
+		}
+
+		leaves := make([]*Leaf, 0, capacity)
+		for i := uint64(0); i < count; i++ {
+			leaf := &Leaf{}
+			if err := leaf.Deserialize(r); err != nil {
+				return errors.Wrapf(err, "level %d leaf %d", level, i)
+			}
+
+			leaves = append(leaves, leaf)
+		}
+
+		p.Path[level] = leaves
+	}
+
+	return nil
+}
+
+func (l Leaf) Serialize(w io.Writer) error {
+	if err := wire.WriteVarInt(w, txProtocolVersion, l.Offset); err != nil {
+		return errors.Wrap(err, "offset")
+	}
+
+	if _, err := w.Write([]byte{l.Flags()}); err != nil {
+		return errors.Wrap(err, "flags")
+	}
+
+	if l.Duplicate {
+		return nil
+	}
+
+	if l.Hash == nil {
+		return ErrMissingHash
+	}
+
+	if _, err := w.Write(l.Hash[:]); err != nil {
+		return errors.Wrap(err, "hash")
+	}
+
+	return nil
+}
+
+func (l *Leaf) Deserialize(r io.Reader) error {
+	offset, err := wire.ReadVarInt(r, txProtocolVersion)
+	if err != nil {
+		return errors.Wrap(err, "offset")
+	}
+	l.Offset = offset
+
+	var flags [1]byte
+	if _, err := io.ReadFull(r, flags[:]); err != nil {
+		return errors.Wrap(err, "flags")
+	}
+
+	switch flags[0] {
+	case 0:
+	case FlagDuplicate:
+		l.Duplicate = true
+		return nil
+	case FlagTxID:
+		l.TxID = true
+	default:
+		return errors.Wrapf(ErrInvalidFlags, "0x%02x", flags[0])
+	}
+
+	hash := &bitcoin.Hash32{}
+	if _, err := io.ReadFull(r, hash[:]); err != nil {
+		return errors.Wrap(err, "hash")
+	}
+	l.Hash = hash
+
+	return nil
+}
+
+// Flags returns the BRC-74 flags byte for the leaf.
+func (l Leaf) Flags() byte {
+	var result byte
+	if l.Duplicate {
+		result |= FlagDuplicate
+	}
+	if l.TxID {
+		result |= FlagTxID
+	}
+	return result
+}
+
+// Bytes returns the binary encoding of the merkle path.
+func (p MerklePath) Bytes() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := p.Serialize(buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// String returns the hex encoding of the merkle path.
+func (p MerklePath) String() string {
+	b, err := p.Bytes()
+	if err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+func (p MerklePath) MarshalText() ([]byte, error) {
+	b, err := p.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+func (p *MerklePath) UnmarshalText(text []byte) error {
+	result, err := ParseHex(string(text))
+	if err != nil {
+		return err
+	}
+
+	*p = *result
+	return nil
+}
+
+// TxIDs returns the txids the path is for.
+func (p MerklePath) TxIDs() []bitcoin.Hash32 {
+	if len(p.Path) == 0 {
+		return nil
+	}
+
+	var result []bitcoin.Hash32
+	for _, leaf := range p.Path[0] {
+		if leaf.TxID && leaf.Hash != nil {
+			result = append(result, *leaf.Hash)
+		}
+	}
+
+	return result
+}
+
+// Index returns the index of the tx in the block.
+func (p MerklePath) Index(txid bitcoin.Hash32) (uint64, error) {
+	if len(p.Path) == 0 {
+		return 0, errors.Wrap(ErrTxNotFound, txid.String())
+	}
+
+	for _, leaf := range p.Path[0] {
+		if leaf.Hash != nil && leaf.Hash.Equal(&txid) {
+			return leaf.Offset, nil
+		}
+	}
+
+	return 0, errors.Wrap(ErrTxNotFound, txid.String())
+}
+
+// Contains returns true if the tx is in the path.
+func (p MerklePath) Contains(txid bitcoin.Hash32) bool {
+	_, err := p.Index(txid)
+	return err == nil
+}
+
+// ComputeRoot calculates the merkle root of the block using the path of the tx.
+func (p MerklePath) ComputeRoot(txid bitcoin.Hash32) (bitcoin.Hash32, error) {
+	offset, err := p.Index(txid)
+	if err != nil {
+		return bitcoin.Hash32{}, err
+	}
+
+	if len(p.Path) == 1 && len(p.Path[0]) == 1 {
+		return txid, nil // only tx in block
+	}
+
+	hash := txid
+	for level := range p.Path {
+		sibling, isDuplicate, err := p.node(level, offset^1)
+		if err != nil {
+			return bitcoin.Hash32{}, errors.Wrapf(err, "level %d", level)
+		}
+
+		if isDuplicate {
+			hash = hashPair(hash, hash)
+		} else if offset%2 == 0 {
+			hash = hashPair(hash, sibling)
+		} else {
+			hash = hashPair(sibling, hash)
+		}
+
+		offset /= 2
+	}
+
+	return hash, nil
+}
+
+// Extract returns a merkle path containing only the leaves needed for the tx.
+func (p MerklePath) Extract(txid bitcoin.Hash32) (*MerklePath, error) {
+	offset, err := p.Index(txid)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MerklePath{
+		BlockHeight: p.BlockHeight,
+		Path:        make([][]*Leaf, len(p.Path)),
+	}
+
+	for level := range p.Path {
+		siblingOffset := offset ^ 1
+		sibling := &Leaf{
+			Offset: siblingOffset,
+		}
+
+		hash, isDuplicate, err := p.node(level, siblingOffset)
+		if err != nil {
+			return nil, errors.Wrapf(err, "level %d", level)
+		}
+
+		if isDuplicate {
+			sibling.Duplicate = true
+		} else {
+			sibling.Hash = &hash
+		}
+
+		if level == 0 {
+			txLeaf := &Leaf{
+				Offset: offset,
+				Hash:   &txid,
+				TxID:   true,
+			}
+
+			if offset < siblingOffset {
+				result.Path[level] = []*Leaf{txLeaf, sibling}
+			} else {
+				result.Path[level] = []*Leaf{sibling, txLeaf}
+			}
+		} else {
+			result.Path[level] = []*Leaf{sibling}
+		}
+
+		offset /= 2
+	}
+
+	return result, nil
+}
+
+// MerkleProof converts the path of the tx to a merkle proof. The block hash and header aren't in
+// the path so they aren't set.
+func (p MerklePath) MerkleProof(txid bitcoin.Hash32) (*merkle_proof.MerkleProof, error) {
+	offset, err := p.Index(txid)
+	if err != nil {
+		return nil, err
+	}
+
+	result := merkle_proof.NewMerkleProof(txid)
+	result.Index = int(offset)
+
+	if len(p.Path) == 1 && len(p.Path[0]) == 1 {
+		return result, nil // only tx in block
+	}
+
+	for level := range p.Path {
+		sibling, isDuplicate, err := p.node(level, offset^1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "level %d", level)
+		}
+
+		if isDuplicate {
+			// Merkle proof duplicate indexes are the 1 based layer.
+			result.DuplicatedIndexes = append(result.DuplicatedIndexes, level+1)
+		} else {
+			result.Path = append(result.Path, sibling)
+		}
+
+		offset /= 2
+	}
+
+	return result, nil
+}
+
+// Combine adds the leaves of the other merkle path so the path proves the txs of both. The other
+// path must be for the same block.
+func (p *MerklePath) Combine(other MerklePath) error {
+	if p.BlockHeight != other.BlockHeight || len(p.Path) != len(other.Path) {
+		return errors.Wrapf(ErrDifferentBlock, "height %d, other height %d", p.BlockHeight,
+			other.BlockHeight)
+	}
+
+	root, err := p.root()
+	if err != nil {
+		return errors.Wrap(err, "root")
+	}
+
+	otherRoot, err := other.root()
+	if err != nil {
+		return errors.Wrap(err, "other root")
+	}
+
+	if !root.Equal(&otherRoot) {
+		return errors.Wrapf(ErrDifferentBlock, "root %s, other root %s", root, otherRoot)
+	}
+
+	for level, leaves := range other.Path {
+		for _, leaf := range leaves {
+			existing := p.leaf(level, leaf.Offset)
+			if existing == nil {
+				c := *leaf
+				p.Path[level] = append(p.Path[level], &c)
+				continue
+			}
+
+			if leaf.TxID {
+				existing.TxID = true
+			}
+		}
+
+		sort.Slice(p.Path[level], func(i, j int) bool {
+			return p.Path[level][i].Offset < p.Path[level][j].Offset
+		})
+	}
+
+	return nil
+}
+
+// root returns the merkle root calculated from the first txid in the path.
+func (p MerklePath) root() (bitcoin.Hash32, error) {
+	txids := p.TxIDs()
+	if len(txids) == 0 {
+		return bitcoin.Hash32{}, ErrTxNotFound
+	}
+
+	return p.ComputeRoot(txids[0])
+}
+
+// leaf returns the leaf at the offset in the level or nil if it isn't in the path.
+func (p MerklePath) leaf(level int, offset uint64) *Leaf {
+	for _, leaf := range p.Path[level] {
+		if leaf.Offset == offset {
+			return leaf
+		}
+	}
+
+	return nil
+}
+
+// node returns the hash of the node at the offset in the level. Nodes that aren't in the path are
+// calculated from the level below. isDuplicate is true when the node is marked as a duplicate of
+// its sibling.
+func (p MerklePath) node(level int, offset uint64) (bitcoin.Hash32, bool, error) {
+	leaf := p.leaf(level, offset)
+	if leaf != nil {
+		if leaf.Duplicate {
+			return bitcoin.Hash32{}, true, nil
+		}
+
+		if leaf.Hash != nil {
+			return *leaf.Hash, false, nil
+		}
+	}
+
+	if level == 0 {
+		return bitcoin.Hash32{}, false, errors.Wrapf(ErrMissingHash, "offset %d", offset)
+	}
+
+	left, _, err := p.node(level-1, offset*2)
+	if err != nil {
+		return bitcoin.Hash32{}, false, err
+	}
+
+	right, isDuplicate, err := p.node(level-1, offset*2+1)
+	if err != nil {
+		return bitcoin.Hash32{}, false, err
+	}
+
+	if isDuplicate {
+		right = left
+	}
+
+	return hashPair(left, right), false, nil
+}
+
+func hashPair(left, right bitcoin.Hash32) bitcoin.Hash32 {
+	s := sha256.New()
+	s.Write(left[:])
+	s.Write(right[:])
+	return bitcoin.Hash32(sha256.Sum256(s.Sum(nil)))
+}
@@ -0,0 +1,204 @@
+package bump
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/pkg/errors"
+)
+
+// brc74Example is the example merkle path from https://bsv.brc.dev/transactions/0074
+const (
+	brc74Example = "fe8a6a0c000c04fde80b0011774f01d26412f0d16ea3f0447be0b5ebec67b0782e321a7a01cbdf" +
+		"7f734e30fde90b02004e53753e3fe4667073063a17987292cfdea278824e9888e52180581d7188d8fdea0b025e" +
+		"441996fc53f0191d649e68a200e752fb5f39e0d5617083408fa179ddc5c998fdeb0b0102fdf405000671394f72" +
+		"237d08a4277f4435e5b6edf7adc272f25effef27cdfe805ce71a81fdf50500262bccabec6c4af3ed00cc7a7414" +
+		"edea9c5efa92fb8623dd6160a001450a528201fdfb020101fd7c010093b3efca9b77ddec914f8effac691ecb54" +
+		"e2c81d0ab81cbc4c4b93befe418e8501bf01015e005881826eb6973c54003a02118fe270f03d46d02681c8bc71" +
+		"cd44c613e86302f8012e00e07a2bb8bb75e5accff266022e1e5e6e7b4d6d943a04faadcf2ab4a22f796ff30116" +
+		"008120cafa17309c0bb0e0ffce835286b3a2dcae48e4497ae2d2b7ced4f051507d010a00502e59ac92f46543c2" +
+		"3006bff855d96f5e648043f0fb87a7a5949e6a9bebae430104001ccd9f8f64f4d0489b30cc815351cf425e0e78" +
+		"ad79a589350e4341ac165dbe45010301010000af8764ce7e1cc132ab5ed2229a005c87201c9a5ee15c0f91dd53" +
+		"eff31ab30cd4"
+	brc74ExampleRoot = "57aab6e6fb1b697174ffb64e062c4728f2ffd33ddcfa02a43b64d8cd29b483b4"
+)
+
+func Test_MerklePath_Example(t *testing.T) {
+	path, err := ParseHex(brc74Example)
+	if err != nil {
+		t.Fatalf("Failed to parse merkle path : %s", err)
+	}
+
+	if path.BlockHeight != 813706 {
+		t.Fatalf("Wrong block height : got %d, want %d", path.BlockHeight, 813706)
+	}
+
+	if path.String() != brc74Example {
+		t.Fatalf("Wrong re-encoded merkle path : \n  got %s\n want %s", path.String(),
+			brc74Example)
+	}
+
+	wantRoot, _ := bitcoin.NewHash32FromStr(brc74ExampleRoot)
+	txids := path.TxIDs()
+	if len(txids) != 2 {
+		t.Fatalf("Wrong txid count : got %d, want %d", len(txids), 2)
+	}
+
+	for _, txid := range txids {
+		root, err := path.ComputeRoot(txid)
+		if err != nil {
+			t.Fatalf("Failed to compute root : %s", err)
+		}
+
+		if !root.Equal(wantRoot) {
+			t.Fatalf("Wrong root : got %s, want %s", root, wantRoot)
+		}
+
+		extracted, err := path.Extract(txid)
+		if err != nil {
+			t.Fatalf("Failed to extract path : %s", err)
+		}
+		t.Logf("Extracted path for %s : %s", txid, extracted)
+
+		if len(extracted.TxIDs()) != 1 {
+			t.Fatalf("Wrong extracted txid count : got %d, want %d", len(extracted.TxIDs()), 1)
+		}
+
+		root, err = extracted.ComputeRoot(txid)
+		if err != nil {
+			t.Fatalf("Failed to compute extracted root : %s", err)
+		}
+
+		if !root.Equal(wantRoot) {
+			t.Fatalf("Wrong extracted root : got %s, want %s", root, wantRoot)
+		}
+
+		proof, err := path.MerkleProof(txid)
+		if err != nil {
+			t.Fatalf("Failed to convert merkle proof : %s", err)
+		}
+
+		proof.MerkleRoot = wantRoot
+		if err := proof.Verify(); err != nil {
+			t.Fatalf("Failed to verify merkle proof : %s", err)
+		}
+	}
+
+	if _, err := path.ComputeRoot(bitcoin.Hash32{}); err == nil {
+		t.Fatalf("Compute root should fail for missing txid")
+	}
+}
+
+func Test_MerklePath_Generated(t *testing.T) {
+	for count := 1; count <= 11; count++ {
+		txids := make([]bitcoin.Hash32, count)
+		for i := range txids {
+			rand.Read(txids[i][:])
+		}
+		wantRoot := MerkleRoot(txids)
+
+		var combined *MerklePath
+
+		for index, txid := range txids {
+			path, err := NewMerklePath(1000, txids, index)
+			if err != nil {
+				t.Fatalf("Failed to create merkle path : %s", err)
+			}
+
+			parsed, err := ParseHex(path.String())
+			if err != nil {
+				t.Fatalf("Failed to parse merkle path : %s", err)
+			}
+
+			if parsed.String() != path.String() {
+				t.Fatalf("Wrong re-encoded merkle path : \n  got %s\n want %s", parsed,
+					path)
+			}
+
+			root, err := parsed.ComputeRoot(txid)
+			if err != nil {
+				t.Fatalf("Failed to compute root (%d txs, index %d) : %s", count, index, err)
+			}
+
+			if !root.Equal(&wantRoot) {
+				t.Fatalf("Wrong root (%d txs, index %d) : got %s, want %s", count, index, root,
+					wantRoot)
+			}
+
+			proof, err := parsed.MerkleProof(txid)
+			if err != nil {
+				t.Fatalf("Failed to convert merkle proof : %s", err)
+			}
+
+			if proof.Index != index {
+				t.Fatalf("Wrong merkle proof index : got %d, want %d", proof.Index, index)
+			}
+
+			proof.MerkleRoot = &wantRoot
+			if err := proof.Verify(); err != nil {
+				t.Fatalf("Failed to verify merkle proof (%d txs, index %d) : %s", count, index,
+					err)
+			}
+
+			fromProof, err := NewMerklePathFromProof(1000, proof)
+			if err != nil {
+				t.Fatalf("Failed to convert from merkle proof : %s", err)
+			}
+
+			if fromProof.String() != path.String() {
+				t.Fatalf("Wrong merkle path from proof : \n  got %s\n want %s", fromProof, path)
+			}
+
+			if combined == nil {
+				combined = fromProof
+			} else if err := combined.Combine(*fromProof); err != nil {
+				t.Fatalf("Failed to combine merkle paths : %s", err)
+			}
+		}
+
+		if len(combined.TxIDs()) != count {
+			t.Fatalf("Wrong combined txid count : got %d, want %d", len(combined.TxIDs()), count)
+		}
+
+		for _, txid := range txids {
+			root, err := combined.ComputeRoot(txid)
+			if err != nil {
+				t.Fatalf("Failed to compute combined root : %s", err)
+			}
+
+			if !root.Equal(&wantRoot) {
+				t.Fatalf("Wrong combined root : got %s, want %s", root, wantRoot)
+			}
+		}
+
+		other, _ := NewMerklePath(1000, []bitcoin.Hash32{txids[0], {}}, 0)
+		if err := combined.Combine(*other); !errors.Is(err, ErrDifferentBlock) {
+			t.Fatalf("Wrong combine error : got %v, want %s", err, ErrDifferentBlock)
+		}
+	}
+}
+
+func Test_MerklePath_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+	}{
+		{"empty", ""},
+		{"truncated", brc74Example[:100]},
+		{"extra", brc74Example + "00"},
+		{"tree height", "0141"},
+		{"flags", "01010100" + "04"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseHex(tt.hex); err == nil {
+				t.Fatalf("Parse should fail")
+			} else {
+				t.Logf("Error : %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package tef
+
+import (
+	"sync"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+	"github.com/tokenized/pkg/wire"
+)
+
+const (
+	// maxPooledBufferSize is the max capacity of buffers that are returned to the pool so a few
+	// very large txs or batches don't keep their memory allocated.
+	maxPooledBufferSize = 1 << 24
+)
+
+var (
+	bufferPool = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, 0, 4096)
+			return &b
+		},
+	}
+)
+
+// SerializeSize returns the size of the tx in the extended format. A MissingSpentOutputsError is
+// returned if the outputs spent by any inputs, other than coinbase inputs, aren't available.
+func SerializeSize(tx expanded_tx.TransactionWithOutputs) (int, error) {
+	msgTx := tx.GetMsgTx()
+
+	size := 4 + wire.VarIntSerializeSize(uint64(len(msgTx.TxIn)))
+	if len(msgTx.TxIn) > 0 {
+		size += len(Marker)
+	}
+
+	for inputIndex, input := range msgTx.TxIn {
+		_, script, ok := spentOutput(tx, input, inputIndex)
+		if !ok {
+			return 0, MissingSpentOutputsError{Inputs: MissingInputs(tx)}
+		}
+
+		size += input.SerializeSize() + 8 + wire.VarIntSerializeSize(uint64(len(script))) +
+			len(script)
+	}
+
+	size += wire.VarIntSerializeSize(uint64(len(msgTx.TxOut)))
+	for _, output := range msgTx.TxOut {
+		size += output.SerializeSize()
+	}
+
+	return size + 4, nil
+}
+
+// AppendSerialize appends the tx in the extended format to b and returns the extended slice. It
+// only allocates when b doesn't have the capacity for the tx. On error b is returned unchanged.
+func AppendSerialize(b []byte, tx expanded_tx.TransactionWithOutputs) ([]byte, error) {
+	start := len(b)
+	msgTx := tx.GetMsgTx()
+	b = appendUint32(b, uint32(msgTx.Version))
+
+	if len(msgTx.TxIn) > 0 {
+		// There is no need for extended format if there are no inputs.
+		b = append(b, Marker...)
+	}
+
+	b = appendVarInt(b, uint64(len(msgTx.TxIn)))
+	for inputIndex, input := range msgTx.TxIn {
+		value, script, ok := spentOutput(tx, input, inputIndex)
+		if !ok {
+			return b[:start], MissingSpentOutputsError{Inputs: MissingInputs(tx)}
+		}
+
+		b = append(b, input.PreviousOutPoint.Hash[:]...)
+		b = appendUint32(b, input.PreviousOutPoint.Index)
+		b = appendScript(b, input.UnlockingScript)
+		b = appendUint32(b, input.Sequence)
+		b = appendUint64(b, value)
+		b = appendScript(b, script)
+	}
+
+	b = appendVarInt(b, uint64(len(msgTx.TxOut)))
+	for _, output := range msgTx.TxOut {
+		b = appendUint64(b, output.Value)
+		b = appendScript(b, output.LockingScript)
+	}
+
+	return appendUint32(b, msgTx.LockTime), nil
+}
+
+// spentOutput returns the value and locking script of the output spent by the input. Coinbase
+// inputs return an empty output. Spent outputs of expanded txs are returned without allocating.
+func spentOutput(tx expanded_tx.TransactionWithOutputs, input *wire.TxIn,
+	inputIndex int) (uint64, bitcoin.Script, bool) {
+
+	if input.PreviousOutPoint.Hash.IsZero() { // coinbase input
+		return 0, nil, true
+	}
+
+	if etx, ok := tx.(*expanded_tx.ExpandedTx); ok && inputIndex < len(etx.SpentOutputs) &&
+		etx.SpentOutputs[inputIndex] != nil {
+		output := etx.SpentOutputs[inputIndex]
+		return output.Value, output.LockingScript, true
+	}
+
+	output, err := tx.InputOutput(inputIndex)
+	if err != nil {
+		return 0, nil, false
+	}
+
+	return output.Value, output.LockingScript, true
+}
+
+// GetBuffer returns an empty buffer from the pool for serializing txs with AppendSerialize.
+func GetBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+// PutBuffer returns the buffer to the pool. Nothing can point into it after it is returned.
+func PutBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBufferSize {
+		return
+	}
+
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24), byte(v>>32), byte(v>>40),
+		byte(v>>48), byte(v>>56))
+}
+
+func appendVarInt(b []byte, v uint64) []byte {
+	switch {
+	case v < 0xfd:
+		return append(b, byte(v))
+	case v <= 0xffff:
+		return append(b, 0xfd, byte(v), byte(v>>8))
+	case v <= 0xffffffff:
+		return appendUint32(append(b, 0xfe), uint32(v))
+	default:
+		return appendUint64(append(b, 0xff), v)
+	}
+}
+
+func appendScript(b []byte, script bitcoin.Script) []byte {
+	return append(appendVarInt(b, uint64(len(script))), script...)
+}
@@ -0,0 +1,149 @@
+package tef
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tokenized/arc/internal/txtest"
+	"github.com/tokenized/pkg/expanded_tx"
+	"github.com/tokenized/pkg/wire"
+)
+
+// testAppendTx returns a tx with signature sized unlocking scripts. Its spent outputs are set
+// instead of its ancestors so they don't have to be searched while serializing.
+func testAppendTx(inputCount, outputCount int) *expanded_tx.ExpandedTx {
+	var values []uint64
+	for i := 0; i < outputCount; i++ {
+		values = append(values, uint64(500+i))
+	}
+
+	etx := txtest.NewExpandedTx(inputCount, values...)
+	for i, input := range etx.Tx.TxIn {
+		input.UnlockingScript = make([]byte, 107)
+		etx.SpentOutputs = append(etx.SpentOutputs, &expanded_tx.Output{
+			Value:         txtest.ParentValue,
+			LockingScript: etx.Ancestors[i].Tx.TxOut[0].LockingScript,
+		})
+	}
+	etx.Ancestors = nil
+
+	return etx
+}
+
+func Test_AppendSerialize(t *testing.T) {
+	etx := testAppendTx(300, 3) // enough inputs for a multi byte varint
+	txid := *etx.Tx.TxHash()
+
+	size, err := SerializeSize(etx)
+	if err != nil {
+		t.Fatalf("Failed to get serialize size : %s", err)
+	}
+
+	prefix := []byte{0x01, 0x02, 0x03}
+	b, err := AppendSerialize(prefix, etx)
+	if err != nil {
+		t.Fatalf("Failed to append serialize : %s", err)
+	}
+
+	if len(b) != len(prefix)+size {
+		t.Fatalf("Wrong size : got %d, want %d", len(b)-len(prefix), size)
+	}
+
+	if !bytes.Equal(b[:len(prefix)], prefix) {
+		t.Fatalf("Wrong prefix : got %x, want %x", b[:len(prefix)], prefix)
+	}
+
+	// Check the extended bytes are the raw tx bytes with the marker and spent outputs inserted.
+	raw := &bytes.Buffer{}
+	etx.Tx.Serialize(raw)
+	want := &bytes.Buffer{}
+	want.Write(raw.Bytes()[:4])
+	want.Write(Marker)
+	wire.WriteVarInt(want, txProtocolVersion, uint64(len(etx.Tx.TxIn)))
+	for i, input := range etx.Tx.TxIn {
+		input.Serialize(want, txProtocolVersion, 0)
+		output := wire.NewTxOut(etx.SpentOutputs[i].Value, etx.SpentOutputs[i].LockingScript)
+		output.Serialize(want, txProtocolVersion, 0)
+	}
+	wire.WriteVarInt(want, txProtocolVersion, uint64(len(etx.Tx.TxOut)))
+	for _, output := range etx.Tx.TxOut {
+		output.Serialize(want, txProtocolVersion, 0)
+	}
+	want.Write(raw.Bytes()[raw.Len()-4:])
+
+	if !bytes.Equal(b[len(prefix):], want.Bytes()) {
+		t.Fatalf("Wrong extended bytes : \n   got %x\n  want %x", b[len(prefix):], want.Bytes())
+	}
+
+	decoder := NewDecoder(bytes.NewReader(b[len(prefix):]))
+	if _, err := decoder.Next(); err != nil {
+		t.Fatalf("Failed to deserialize : %s", err)
+	}
+
+	if dtxid := decoder.TxID(); !dtxid.Equal(&txid) {
+		t.Fatalf("Wrong txid : got %s, want %s", dtxid, txid)
+	}
+
+	// Appending into a buffer with enough capacity doesn't allocate.
+	buf := make([]byte, 0, size)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := AppendSerialize(buf[:0], etx); err != nil {
+			t.Fatalf("Failed to append serialize : %s", err)
+		}
+	})
+
+	if allocs != 0 {
+		t.Fatalf("Wrong allocation count : got %f, want %d", allocs, 0)
+	}
+}
+
+func Benchmark_Serialize(b *testing.B) {
+	etx := testAppendTx(2, 2)
+	w := &bytes.Buffer{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Reset()
+		if err := Serialize(w, etx); err != nil {
+			b.Fatalf("Failed to serialize : %s", err)
+		}
+	}
+}
+
+func Benchmark_AppendSerialize(b *testing.B) {
+	etx := testAppendTx(2, 2)
+	var buf []byte
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		buf, err = AppendSerialize(buf[:0], etx)
+		if err != nil {
+			b.Fatalf("Failed to serialize : %s", err)
+		}
+	}
+}
+
+func Benchmark_Decoder(b *testing.B) {
+	buf := &bytes.Buffer{}
+	for i := 0; i < 100; i++ {
+		if err := Serialize(buf, testAppendTx(2, 2)); err != nil {
+			b.Fatalf("Failed to serialize : %s", err)
+		}
+	}
+	txsBytes := buf.Bytes()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(txsBytes)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decoder := NewDecoder(bytes.NewReader(txsBytes))
+		for decoder.More() {
+			if _, err := decoder.Next(); err != nil {
+				b.Fatalf("Failed to decode : %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package tef
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+)
+
+// Decoder reads a stream of concatenated extended or raw txs one at a time so large batches don't
+// have to be decoded all at once.
+type Decoder struct {
+	r      *bufio.Reader
+	count  *countingReader
+	limits Limits
+
+	index int
+	txid  bitcoin.Hash32
+	err   error
+}
+
+// DecodeError is returned by the decoder when a tx in the stream is invalid.
+type DecodeError struct {
+	// Index is the index of the tx among the txs decoded by Next or skipped by Advance.
+	Index int
+
+	// Offset is the byte offset of the start of the tx within the stream.
+	Offset int64
+
+	// ErrorOffset is the byte offset within the stream where decoding failed.
+	ErrorOffset int64
+
+	Err error
+}
+
+type countingReader struct {
+	r      io.Reader
+	offset int64
+}
+
+// NewDecoder returns a decoder that uses the default limits.
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderWithLimits(r, DefaultLimits())
+}
+
+// NewDecoderWithLimits returns a decoder that returns ErrLimitExceeded when a tx is larger than the
+// limits.
+func NewDecoderWithLimits(r io.Reader, limits Limits) *Decoder {
+	br := bufio.NewReader(r)
+	return &Decoder{
+		r:      br,
+		count:  &countingReader{r: br},
+		limits: limits,
+	}
+}
+
+// More returns true if there is more data in the stream. It returns false after an error. Err
+// returns the error when the stream couldn't be read.
+func (d *Decoder) More() bool {
+	if d.err != nil {
+		return false
+	}
+
+	if _, err := d.r.Peek(1); err != nil {
+		if err != io.EOF {
+			d.err = &DecodeError{
+				Index:       d.index,
+				Offset:      d.count.offset,
+				ErrorOffset: d.count.offset,
+				Err:         err,
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// Next decodes the next tx in the stream. It returns io.EOF when the stream is empty. Decode
+// errors are a *DecodeError and are returned from all later calls.
+func (d *Decoder) Next() (*expanded_tx.ExpandedTx, error) {
+	if !d.More() {
+		if d.err != nil {
+			return nil, d.err
+		}
+		return nil, io.EOF
+	}
+
+	start := d.count.offset
+	etx, txid, err := deserialize(d.count, d.limits)
+	if err != nil {
+		d.err = &DecodeError{
+			Index:       d.index,
+			Offset:      start,
+			ErrorOffset: d.count.offset,
+			Err:         err,
+		}
+		return nil, d.err
+	}
+
+	d.index++
+	d.txid = txid
+	return etx, nil
+}
+
+// Err returns the first error from reading or decoding the stream, or nil at the end of the
+// stream.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Advance counts a tx that was decoded from Reader so that Count, TxID, and the index of later
+// decode errors include it.
+func (d *Decoder) Advance(txid bitcoin.Hash32) {
+	d.index++
+	d.txid = txid
+}
+
+// TxID returns the txid of the last tx returned by Next, which is calculated while the tx is
+// decoded, or passed to Advance.
+func (d *Decoder) TxID() bitcoin.Hash32 {
+	return d.txid
+}
+
+// Count returns the number of txs decoded, including those counted by Advance.
+func (d *Decoder) Count() int {
+	return d.index
+}
+
+// Offset returns the number of bytes of the stream that have been consumed.
+func (d *Decoder) Offset() int64 {
+	return d.count.offset
+}
+
+// Peek returns the next n bytes of the stream without consuming them.
+func (d *Decoder) Peek(n int) ([]byte, error) {
+	return d.r.Peek(n)
+}
+
+// Reader returns a reader of the stream at the current position so that other formats can be
+// decoded from it. Bytes read from it are included in the offset. Call Advance after each tx is
+// decoded from it.
+func (d *Decoder) Reader() io.Reader {
+	return d.count
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("tx %d at offset %d: offset %d: %s", e.Index, e.Offset, e.ErrorOffset,
+		e.Err)
+}
+
+func (e *DecodeError) Cause() error {
+	return e.Err
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,179 @@
+package tef
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/tokenized/arc/internal/txtest"
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/pkg/errors"
+)
+
+func testDecoderTxs(t *testing.T, count int) ([]bitcoin.Hash32, []byte) {
+	buf := &bytes.Buffer{}
+	var txids []bitcoin.Hash32
+	for i := 0; i < count; i++ {
+		etx := txtest.NewExpandedTx(1, 9990)
+		tx := etx.Tx
+		txids = append(txids, *tx.TxHash())
+
+		if i%2 == 1 {
+			// Mix raw txs in with the extended txs.
+			if err := tx.Serialize(buf); err != nil {
+				t.Fatalf("Failed to serialize tx : %s", err)
+			}
+			continue
+		}
+
+		if err := Serialize(buf, etx); err != nil {
+			t.Fatalf("Failed to serialize tx : %s", err)
+		}
+	}
+
+	return txids, buf.Bytes()
+}
+
+func Test_Decoder_Batch(t *testing.T) {
+	txids, b := testDecoderTxs(t, 5)
+
+	decoder := NewDecoder(bytes.NewReader(b))
+	for decoder.More() {
+		etx, err := decoder.Next()
+		if err != nil {
+			t.Fatalf("Failed to decode tx : %s", err)
+		}
+
+		index := decoder.Count() - 1
+		txid := decoder.TxID()
+		t.Logf("Tx %d : %s", index, txid)
+
+		if !txid.Equal(&txids[index]) {
+			t.Fatalf("Wrong txid %d : got %s, want %s", index, txid, txids[index])
+		}
+
+		if etxid := etx.TxID(); !etxid.Equal(&txid) {
+			t.Fatalf("Wrong tx %d : got %s, want %s", index, etxid, txid)
+		}
+
+		if wantExtended := index%2 == 0; (len(etx.SpentOutputs) > 0) != wantExtended {
+			t.Fatalf("Wrong extended %d : got %d spent outputs", index, len(etx.SpentOutputs))
+		}
+	}
+
+	if decoder.Count() != len(txids) {
+		t.Fatalf("Wrong tx count : got %d, want %d", decoder.Count(), len(txids))
+	}
+
+	if decoder.Offset() != int64(len(b)) {
+		t.Fatalf("Wrong offset : got %d, want %d", decoder.Offset(), len(b))
+	}
+
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Fatalf("Wrong end error : got %v, want %s", err, io.EOF)
+	}
+}
+
+func Test_Decoder_Truncated(t *testing.T) {
+	_, b := testDecoderTxs(t, 3)
+
+	// Find the start of the last tx.
+	decoder := NewDecoder(bytes.NewReader(b))
+	for i := 0; i < 2; i++ {
+		if _, err := decoder.Next(); err != nil {
+			t.Fatalf("Failed to decode tx : %s", err)
+		}
+	}
+	lastOffset := decoder.Offset()
+
+	decoder = NewDecoder(bytes.NewReader(b[:len(b)-10]))
+	for decoder.More() {
+		if _, err := decoder.Next(); err != nil {
+			t.Logf("Decode error : %s", err)
+
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("Error should be a decode error : %s", err)
+			}
+
+			if decodeErr.Index != 2 {
+				t.Fatalf("Wrong error index : got %d, want %d", decodeErr.Index, 2)
+			}
+
+			if decodeErr.Offset != lastOffset {
+				t.Fatalf("Wrong error offset : got %d, want %d", decodeErr.Offset, lastOffset)
+			}
+
+			if decodeErr.ErrorOffset != int64(len(b)-10) {
+				t.Fatalf("Wrong error failure offset : got %d, want %d", decodeErr.ErrorOffset,
+					len(b)-10)
+			}
+
+			if _, nextErr := decoder.Next(); nextErr != err {
+				t.Fatalf("Error should be returned again : got %v, want %s", nextErr, err)
+			}
+			return
+		}
+	}
+
+	t.Fatalf("Truncated tx should fail to decode")
+}
+
+func Test_Decoder_ReadError(t *testing.T) {
+	txids, b := testDecoderTxs(t, 2)
+	errRead := errors.New("Read Failed")
+
+	decoder := NewDecoder(io.MultiReader(bytes.NewReader(b), iotest.ErrReader(errRead)))
+	for decoder.More() {
+		if _, err := decoder.Next(); err != nil {
+			t.Fatalf("Failed to decode tx : %s", err)
+		}
+	}
+
+	err := decoder.Err()
+	t.Logf("Read error : %v", err)
+	if errors.Cause(err) != errRead {
+		t.Fatalf("Wrong read error : got %v, want %s", err, errRead)
+	}
+
+	if _, nextErr := decoder.Next(); nextErr != err {
+		t.Fatalf("Error should be returned again : got %v, want %s", nextErr, err)
+	}
+
+	if decoder.Count() != len(txids) {
+		t.Fatalf("Wrong count : got %d, want %d", decoder.Count(), len(txids))
+	}
+}
+
+func Test_Decoder_Advance(t *testing.T) {
+	txids, b := testDecoderTxs(t, 3)
+
+	decoder := NewDecoder(bytes.NewReader(b[:len(b)-10]))
+
+	// Decode the first tx from the reader as if it was another format.
+	etx, err := Deserialize(decoder.Reader())
+	if err != nil {
+		t.Fatalf("Failed to decode tx : %s", err)
+	}
+	decoder.Advance(etx.TxID())
+
+	if txid := decoder.TxID(); !txid.Equal(&txids[0]) {
+		t.Fatalf("Wrong txid : got %s, want %s", txid, txids[0])
+	}
+
+	if _, err := decoder.Next(); err != nil {
+		t.Fatalf("Failed to decode tx : %s", err)
+	}
+
+	_, err = decoder.Next()
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Error should be a decode error : %v", err)
+	}
+
+	if decodeErr.Index != 2 {
+		t.Fatalf("Wrong error index : got %d, want %d", decodeErr.Index, 2)
+	}
+}
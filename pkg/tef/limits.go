@@ -0,0 +1,271 @@
+package tef
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"io"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxTxSize is the default max tx size policy of SV Node.
+	DefaultMaxTxSize = uint64(10000000)
+
+	// minInputSize is the size of an input with an empty unlocking script.
+	minInputSize = 32 + 4 + 1 + 4
+
+	// minOutputSize is the size of an output with an empty locking script.
+	minOutputSize = 8 + 1
+
+	// maxPreallocate is the max number of items allocated before they are read so a small
+	// malicious count doesn't allocate a large amount of memory.
+	maxPreallocate = 1024
+
+	// maxPreallocateScript is the max script size allocated before it is read.
+	maxPreallocateScript = 65536
+)
+
+var (
+	// ErrTruncated means the data ended after the start of the tx, but before the end of it.
+	ErrTruncated = errors.New("Truncated")
+
+	// ErrLimitExceeded means the tx is larger than the limits.
+	ErrLimitExceeded = errors.New("Limit Exceeded")
+
+	// ErrBadMarker means the extended format marker is not followed by a valid extended tx.
+	ErrBadMarker = errors.New("Bad Marker")
+)
+
+// Limits are the max sizes of txs that are deserialized. Zero values are not limited except by
+// MaxTxSize.
+type Limits struct {
+	// MaxTxSize is the max size of the raw tx. The spent outputs of the extended format are not
+	// included.
+	MaxTxSize uint64 `json:"max_tx_size"`
+
+	MaxInputs     uint64 `json:"max_inputs"`
+	MaxOutputs    uint64 `json:"max_outputs"`
+	MaxScriptSize uint64 `json:"max_script_size"`
+}
+
+// txReader reads a tx while enforcing limits. Bytes read through raw are part of the raw tx and are
+// hashed for the txid. Bytes read through extended are only part of the extended format.
+type txReader struct {
+	r      io.Reader
+	limits Limits
+	hasher hash.Hash
+	size   uint64
+}
+
+type rawReader struct {
+	tr *txReader
+}
+
+type extendedReader struct {
+	tr *txReader
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxTxSize: DefaultMaxTxSize,
+	}
+}
+
+func newTxReader(r io.Reader, limits Limits) *txReader {
+	return &txReader{
+		r:      r,
+		limits: limits,
+		hasher: sha256.New(),
+	}
+}
+
+func (tr *txReader) raw() io.Reader {
+	return rawReader{tr: tr}
+}
+
+func (tr *txReader) extended() io.Reader {
+	return extendedReader{tr: tr}
+}
+
+func (tr *txReader) txid() bitcoin.Hash32 {
+	return bitcoin.Hash32(sha256.Sum256(tr.hasher.Sum(nil)))
+}
+
+// resetHash restarts the txid and size after the extended format marker is found.
+func (tr *txReader) resetHash(version int32) error {
+	tr.hasher.Reset()
+	tr.size = 4
+	return binary.Write(tr.hasher, endian, version)
+}
+
+func (tr *txReader) readInputCount() (uint64, error) {
+	count, err := wire.ReadVarInt(tr.raw(), txProtocolVersion)
+	if err != nil {
+		return 0, errors.Wrap(err, "input count")
+	}
+
+	if err := tr.checkCount(count, tr.limits.MaxInputs, minInputSize); err != nil {
+		return 0, errors.Wrapf(err, "input count %d", count)
+	}
+
+	return count, nil
+}
+
+func (tr *txReader) readOutputs(msgTx *wire.MsgTx) error {
+	count, err := wire.ReadVarInt(tr.raw(), txProtocolVersion)
+	if err != nil {
+		return errors.Wrap(err, "output count")
+	}
+
+	if err := tr.checkCount(count, tr.limits.MaxOutputs, minOutputSize); err != nil {
+		return errors.Wrapf(err, "output count %d", count)
+	}
+
+	msgTx.TxOut = make([]*wire.TxOut, 0, preallocateCount(count))
+	for outputIndex := uint64(0); outputIndex < count; outputIndex++ {
+		txout, err := tr.readOutput(tr.raw())
+		if err != nil {
+			return errors.Wrapf(err, "output %d", outputIndex)
+		}
+
+		msgTx.TxOut = append(msgTx.TxOut, txout)
+	}
+
+	return nil
+}
+
+// checkCount returns ErrLimitExceeded if the count is above the max or if that many items of the
+// min size can't fit in the max tx size.
+func (tr *txReader) checkCount(count, max, minSize uint64) error {
+	if max != 0 && count > max {
+		return errors.Wrapf(ErrLimitExceeded, "max %d", max)
+	}
+
+	if tr.limits.MaxTxSize != 0 && count > tr.limits.MaxTxSize/minSize {
+		return errors.Wrapf(ErrLimitExceeded, "max tx size %d", tr.limits.MaxTxSize)
+	}
+
+	return nil
+}
+
+func (tr *txReader) readInput() (*wire.TxIn, error) {
+	raw := tr.raw()
+	input := &wire.TxIn{}
+
+	if _, err := io.ReadFull(raw, input.PreviousOutPoint.Hash[:]); err != nil {
+		return nil, errors.Wrap(err, "previous hash")
+	}
+
+	if err := binary.Read(raw, endian, &input.PreviousOutPoint.Index); err != nil {
+		return nil, errors.Wrap(err, "previous index")
+	}
+
+	script, err := tr.readScript(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "unlocking script")
+	}
+	input.UnlockingScript = script
+
+	if err := binary.Read(raw, endian, &input.Sequence); err != nil {
+		return nil, errors.Wrap(err, "sequence")
+	}
+
+	return input, nil
+}
+
+func (tr *txReader) readOutput(r io.Reader) (*wire.TxOut, error) {
+	output := &wire.TxOut{}
+
+	if err := binary.Read(r, endian, &output.Value); err != nil {
+		return nil, errors.Wrap(err, "value")
+	}
+
+	script, err := tr.readScript(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "locking script")
+	}
+	output.LockingScript = script
+
+	return output, nil
+}
+
+func (tr *txReader) readScript(r io.Reader) (bitcoin.Script, error) {
+	size, err := wire.ReadVarInt(r, txProtocolVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "size")
+	}
+
+	if tr.limits.MaxScriptSize != 0 && size > tr.limits.MaxScriptSize {
+		return nil, errors.Wrapf(ErrLimitExceeded, "script size %d, max %d", size,
+			tr.limits.MaxScriptSize)
+	}
+
+	if tr.limits.MaxTxSize != 0 && size > tr.limits.MaxTxSize {
+		return nil, errors.Wrapf(ErrLimitExceeded, "script size %d, max tx size %d", size,
+			tr.limits.MaxTxSize)
+	}
+
+	if size <= maxPreallocateScript {
+		script := make(bitcoin.Script, size)
+		if _, err := io.ReadFull(r, script); err != nil {
+			return nil, err
+		}
+		return script, nil
+	}
+
+	// Large scripts only allocate as the data is received.
+	buf := &bytes.Buffer{}
+	if _, err := io.CopyN(buf, r, int64(size)); err != nil {
+		return nil, err
+	}
+
+	return bitcoin.Script(buf.Bytes()), nil
+}
+
+// Read reads bytes that are part of the raw tx. The size is checked before reading because
+// io.ReadFull ignores errors returned with the last bytes.
+func (r rawReader) Read(b []byte) (int, error) {
+	if r.tr.limits.MaxTxSize != 0 && r.tr.size+uint64(len(b)) > r.tr.limits.MaxTxSize {
+		return 0, errors.Wrapf(ErrLimitExceeded, "max tx size %d", r.tr.limits.MaxTxSize)
+	}
+
+	n, err := r.tr.r.Read(b)
+	r.tr.hasher.Write(b[:n])
+	r.tr.size += uint64(n)
+
+	if err == io.EOF && r.tr.size == 0 {
+		return n, io.EOF // no tx
+	}
+
+	return n, convertEOF(err)
+}
+
+// Read reads bytes that are only part of the extended format.
+func (r extendedReader) Read(b []byte) (int, error) {
+	n, err := r.tr.r.Read(b)
+	return n, convertEOF(err)
+}
+
+// convertEOF converts the end of the data to ErrTruncated since, after the first byte of the tx,
+// it is only reached before the end of the tx.
+func convertEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+
+	return err
+}
+
+func preallocateCount(count uint64) uint64 {
+	if count > maxPreallocate {
+		return maxPreallocate
+	}
+
+	return count
+}
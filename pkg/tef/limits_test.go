@@ -0,0 +1,153 @@
+package tef
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+func Test_Deserialize_Limits(t *testing.T) {
+	_, b := testDecoderTxs(t, 1)
+
+	tests := []struct {
+		name   string
+		limits Limits
+		err    error
+	}{
+		{
+			name:   "default",
+			limits: DefaultLimits(),
+		},
+		{
+			name:   "unlimited",
+			limits: Limits{},
+		},
+		{
+			name:   "max tx size",
+			limits: Limits{MaxTxSize: 50},
+			err:    ErrLimitExceeded,
+		},
+		{
+			name:   "max inputs",
+			limits: Limits{MaxInputs: 1},
+		},
+		{
+			name:   "max script size",
+			limits: Limits{MaxScriptSize: 10},
+			err:    ErrLimitExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DeserializeWithLimits(bytes.NewReader(b), tt.limits)
+			if tt.err == nil {
+				if err != nil {
+					t.Fatalf("Failed to deserialize : %s", err)
+				}
+				return
+			}
+
+			t.Logf("Deserialize error : %s", err)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Wrong error : got %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func Test_Deserialize_MaliciousCounts(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{
+			// Raw tx claiming 2^64-1 inputs.
+			name: "input count",
+			b: []byte{0x01, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+				0xff},
+			err: ErrLimitExceeded,
+		},
+		{
+			// Extended tx claiming 2^32-1 inputs.
+			name: "extended input count",
+			b: []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xef, 0xfe, 0xff,
+				0xff, 0xff, 0xff},
+			err: ErrLimitExceeded,
+		},
+		{
+			// Tx with no inputs claiming 2^32-1 outputs.
+			name: "output count",
+			b:    []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0xfe, 0xff, 0xff, 0xff, 0xff},
+			err:  ErrLimitExceeded,
+		},
+		{
+			// Output with a 2^32-1 byte locking script.
+			name: "script size",
+			b: []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0xfe, 0xff, 0xff, 0xff, 0xff},
+			err: ErrLimitExceeded,
+		},
+		{
+			// Output with a 1 MB locking script and only a few bytes of it.
+			name: "truncated script",
+			b: []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0xfe, 0x40, 0x42, 0x0f, 0x00, 0x6a},
+			err: ErrTruncated,
+		},
+		{
+			// Extended marker without any inputs.
+			name: "bad marker",
+			b: []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xef, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00},
+			err: ErrBadMarker,
+		},
+		{
+			name: "empty",
+			b:    []byte{},
+			err:  io.EOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Deserialize(bytes.NewReader(tt.b))
+			t.Logf("Deserialize error : %v", err)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Wrong error : got %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func Test_Deserialize_Truncated(t *testing.T) {
+	_, b := testDecoderTxs(t, 1)
+
+	if _, err := Deserialize(bytes.NewReader(nil)); err != io.EOF {
+		t.Fatalf("Wrong error for no data : got %v, want %s", err, io.EOF)
+	}
+
+	for size := 1; size < len(b); size++ {
+		_, err := Deserialize(bytes.NewReader(b[:size]))
+		if !errors.Is(err, ErrTruncated) {
+			t.Fatalf("Wrong error for size %d : got %v, want %s", size, err, ErrTruncated)
+		}
+	}
+
+	tx := wire.NewMsgTx(1)
+	buf := &bytes.Buffer{}
+	if err := tx.Serialize(buf); err != nil {
+		t.Fatalf("Failed to serialize tx : %s", err)
+	}
+
+	// The empty tx is valid when it isn't truncated.
+	if _, err := Deserialize(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Failed to deserialize empty tx : %s", err)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/tokenized/pkg/bitcoin"
 	"github.com/tokenized/pkg/expanded_tx"
 	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
 )
 
 func Test_Serialize_Extended_WithInputsAndOutputs(t *testing.T) {
@@ -303,3 +305,116 @@ func Test_Serialize_NotExtended_WithZeroInputsAndZeroOutputs(t *testing.T) {
 		t.Fatalf("Wrong deserialized txid : \n   got %s\n  want %s", dtxid, txid)
 	}
 }
+
+func Test_Serialize_Extended_Coinbase(t *testing.T) {
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&bitcoin.Hash32{}, 0xffffffff), []byte{0x01, 0x02}))
+	key, _ := bitcoin.GenerateKey(bitcoin.MainNet)
+	lockingScript, _ := key.LockingScript()
+	tx.AddTxOut(wire.NewTxOut(5000000000, lockingScript))
+	txid := *tx.TxHash()
+
+	etx := &expanded_tx.ExpandedTx{
+		Tx: tx,
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Serialize(buf, etx); err != nil {
+		t.Fatalf("Failed to serialize extended format : %s", err)
+	}
+
+	tefBytes := buf.Bytes()
+	t.Logf("TEF bytes : %x", tefBytes)
+
+	// The raw tx plus the marker and an empty spent output with a zero value and script size.
+	wantSize := tx.SerializeSize() + len(Marker) + 8 + 1
+	if len(tefBytes) != wantSize {
+		t.Fatalf("Wrong serialized size : got %d, want %d", len(tefBytes), wantSize)
+	}
+
+	detx, err := Deserialize(bytes.NewReader(tefBytes))
+	if err != nil {
+		t.Fatalf("Failed to deserialize extended format : %s", err)
+	}
+
+	if len(detx.Tx.TxIn) != 1 {
+		t.Fatalf("Wrong deserialized input count : got %d, want %d", len(detx.Tx.TxIn), 1)
+	}
+
+	if len(detx.SpentOutputs) != 1 {
+		t.Fatalf("Wrong deserialized spent output count : got %d, want %d",
+			len(detx.SpentOutputs), 1)
+	}
+
+	if detx.SpentOutputs[0].Value != 0 || len(detx.SpentOutputs[0].LockingScript) != 0 {
+		t.Fatalf("Coinbase spent output should be empty : %+v", detx.SpentOutputs[0])
+	}
+
+	detxid := *detx.Tx.TxHash()
+	if !detxid.Equal(&txid) {
+		t.Fatalf("Wrong deserialized tx txid : \n   got %s\n  want %s", detxid, txid)
+	}
+}
+
+func Test_Serialize_Extended_MissingSpentOutputs(t *testing.T) {
+	inputTx := wire.NewMsgTx(1)
+	inputKey, _ := bitcoin.GenerateKey(bitcoin.MainNet)
+	inputLockingScript, _ := inputKey.LockingScript()
+	inputTx.AddTxOut(wire.NewTxOut(10000, inputLockingScript))
+	inputTx.AddTxOut(wire.NewTxOut(10000, inputLockingScript))
+
+	missingHash := bitcoin.Hash32{0x01}
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(inputTx.TxHash(), 0), nil))
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&missingHash, 3), nil))
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(inputTx.TxHash(), 1), nil))
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&missingHash, 5), nil))
+	key, _ := bitcoin.GenerateKey(bitcoin.MainNet)
+	lockingScript, _ := key.LockingScript()
+	tx.AddTxOut(wire.NewTxOut(9990, lockingScript))
+
+	etx := &expanded_tx.ExpandedTx{
+		Tx: tx,
+		Ancestors: expanded_tx.AncestorTxs{
+			{
+				Tx: inputTx,
+			},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	err := Serialize(buf, etx)
+	t.Logf("Serialize error : %v", err)
+
+	if !errors.Is(err, ErrMissingSpentOutputs) {
+		t.Fatalf("Wrong error : got %v, want %s", err, ErrMissingSpentOutputs)
+	}
+
+	if buf.Len() != 0 {
+		t.Fatalf("Nothing should be written : %x", buf.Bytes())
+	}
+
+	var missingErr MissingSpentOutputsError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("Error should be a missing spent outputs error : %s", err)
+	}
+
+	wantInputs := []MissingInput{
+		{Index: 1, OutPoint: *wire.NewOutPoint(&missingHash, 3)},
+		{Index: 3, OutPoint: *wire.NewOutPoint(&missingHash, 5)},
+	}
+
+	if len(missingErr.Inputs) != len(wantInputs) {
+		t.Fatalf("Wrong missing input count : got %d, want %d", len(missingErr.Inputs),
+			len(wantInputs))
+	}
+
+	for i, want := range wantInputs {
+		got := missingErr.Inputs[i]
+		if got.Index != want.Index || !got.OutPoint.Hash.Equal(&want.OutPoint.Hash) ||
+			got.OutPoint.Index != want.OutPoint.Index {
+			t.Fatalf("Wrong missing input %d : got %d %s, want %d %s", i, got.Index,
+				got.OutPoint, want.Index, want.OutPoint)
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package tef
 
 import (
-	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/tokenized/pkg/bitcoin"
 	"github.com/tokenized/pkg/expanded_tx"
@@ -19,65 +20,59 @@ const (
 )
 
 var (
+	ErrMissingSpentOutputs = errors.New("Missing Spent Outputs")
+
 	Marker = []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0xef}
 
 	endian = binary.LittleEndian
 )
 
-func Serialize(w io.Writer, tx expanded_tx.TransactionWithOutputs) error {
-	msgTx := tx.GetMsgTx()
-	if err := binary.Write(w, endian, msgTx.Version); err != nil {
-		return errors.Wrap(err, "version")
-	}
-
-	inputCount := tx.InputCount()
-	if inputCount > 0 {
-		// There is no need for extended format if there are no inputs.
-		if _, err := w.Write(Marker); err != nil {
-			return errors.Wrap(err, "marker")
-		}
-	}
-
-	if err := wire.WriteVarInt(w, txProtocolVersion, uint64(inputCount)); err != nil {
-		return errors.Wrap(err, "input count")
-	}
-
-	for inputIndex := 0; inputIndex < inputCount; inputIndex++ {
-		input := tx.Input(inputIndex)
+// MissingInput is an input of a tx that doesn't have the output it spends.
+type MissingInput struct {
+	Index    int
+	OutPoint wire.OutPoint
+}
 
-		if input.PreviousOutPoint.Hash.IsZero() { // coinbase input
-			if err := SerializeExtendedInput(w, input, &wire.TxOut{}); err != nil {
-				return errors.Wrapf(err, "input %d", inputIndex)
-			}
-		}
+// MissingSpentOutputsError is returned when a tx can't be serialized in the extended format because
+// the outputs spent by some of its inputs aren't available.
+type MissingSpentOutputsError struct {
+	Inputs []MissingInput
+}
 
-		inputOutput, err := tx.InputOutput(inputIndex)
-		if err != nil {
-			return errors.Wrapf(err, "input output %d", inputIndex)
-		}
+// Serialize writes the tx in the extended format. Coinbase inputs are written once with an empty
+// spent output. A MissingSpentOutputsError is returned before anything is written if the outputs
+// spent by any other inputs aren't available.
+func Serialize(w io.Writer, tx expanded_tx.TransactionWithOutputs) error {
+	buf := GetBuffer()
+	defer PutBuffer(buf)
 
-		if err := SerializeExtendedInput(w, input, inputOutput); err != nil {
-			return errors.Wrapf(err, "input %d", inputIndex)
-		}
+	b, err := AppendSerialize(*buf, tx)
+	if err != nil {
+		return err
 	}
+	*buf = b
 
-	outputCount := tx.OutputCount()
-	if err := wire.WriteVarInt(w, txProtocolVersion, uint64(outputCount)); err != nil {
-		return errors.Wrap(err, "output count")
+	if _, err := w.Write(b); err != nil {
+		return errors.Wrap(err, "write")
 	}
 
-	for outputIndex := 0; outputIndex < outputCount; outputIndex++ {
-		output := tx.Output(outputIndex)
-		if err := output.Serialize(w, txProtocolVersion, 0); err != nil {
-			return errors.Wrapf(err, "output %d", outputIndex)
-		}
-	}
+	return nil
+}
 
-	if err := binary.Write(w, endian, uint32(msgTx.LockTime)); err != nil {
-		return errors.Wrap(err, "lock time")
+// MissingInputs returns the inputs of the tx, other than coinbase inputs, that don't have the
+// outputs they spend.
+func MissingInputs(tx expanded_tx.TransactionWithOutputs) []MissingInput {
+	var result []MissingInput
+	for inputIndex, input := range tx.GetMsgTx().TxIn {
+		if _, _, ok := spentOutput(tx, input, inputIndex); !ok {
+			result = append(result, MissingInput{
+				Index:    inputIndex,
+				OutPoint: input.PreviousOutPoint,
+			})
+		}
 	}
 
-	return nil
+	return result
 }
 
 func SerializeExtendedInput(w io.Writer, input *wire.TxIn, output *wire.TxOut) error {
@@ -92,264 +87,135 @@ func SerializeExtendedInput(w io.Writer, input *wire.TxIn, output *wire.TxOut) e
 	return nil
 }
 
+// Deserialize reads an extended or raw tx using the default limits. It returns io.EOF when there is
+// no data and ErrTruncated when the data ends before the end of the tx.
 func Deserialize(r io.Reader) (*expanded_tx.ExpandedTx, error) {
+	etx, _, err := deserialize(r, DefaultLimits())
+	return etx, err
+}
+
+// DeserializeWithLimits reads an extended or raw tx and returns ErrLimitExceeded if it is larger
+// than the limits.
+func DeserializeWithLimits(r io.Reader, limits Limits) (*expanded_tx.ExpandedTx, error) {
+	etx, _, err := deserialize(r, limits)
+	return etx, err
+}
+
+func DeserializeTxID(r io.Reader) (bitcoin.Hash32, error) {
+	_, txid, err := deserialize(r, DefaultLimits())
+	return txid, err
+}
+
+// deserialize reads an extended or raw tx and calculates its txid from the bytes that are part of
+// the raw tx as they are read.
+func deserialize(r io.Reader, limits Limits) (*expanded_tx.ExpandedTx, bitcoin.Hash32, error) {
+	tr := newTxReader(r, limits)
+	raw := tr.raw()
 	msgTx := &wire.MsgTx{}
 
-	if err := binary.Read(r, endian, &msgTx.Version); err != nil {
-		return nil, errors.Wrap(err, "version")
+	if err := binary.Read(raw, endian, &msgTx.Version); err != nil {
+		if err == io.EOF {
+			return nil, bitcoin.Hash32{}, io.EOF
+		}
+		return nil, bitcoin.Hash32{}, errors.Wrap(err, "version")
 	}
 
-	inputCount, err := wire.ReadVarInt(r, txProtocolVersion)
+	inputCount, err := tr.readInputCount()
 	if err != nil {
-		return nil, errors.Wrap(err, "input count")
+		return nil, bitcoin.Hash32{}, err
 	}
 
 	if inputCount > 0 {
 		// The tx isn't extended.
-		msgTx.TxIn = make([]*wire.TxIn, inputCount)
-		for inputIndex := range msgTx.TxIn {
-			txin := &wire.TxIn{}
-			if err := txin.Deserialize(r, txProtocolVersion, 0); err != nil {
-				return nil, errors.Wrapf(err, "input %d", inputIndex)
+		msgTx.TxIn = make([]*wire.TxIn, 0, preallocateCount(inputCount))
+		for inputIndex := uint64(0); inputIndex < inputCount; inputIndex++ {
+			txin, err := tr.readInput()
+			if err != nil {
+				return nil, bitcoin.Hash32{}, errors.Wrapf(err, "input %d", inputIndex)
 			}
 
-			msgTx.TxIn[inputIndex] = txin
-		}
-
-		outputCount, err := wire.ReadVarInt(r, txProtocolVersion)
-		if err != nil {
-			return nil, errors.Wrap(err, "input count")
+			msgTx.TxIn = append(msgTx.TxIn, txin)
 		}
 
-		msgTx.TxOut = make([]*wire.TxOut, outputCount)
-		for outputIndex := range msgTx.TxOut {
-			txout := &wire.TxOut{}
-			if err := txout.Deserialize(r, txProtocolVersion, 0); err != nil {
-				return nil, errors.Wrapf(err, "output %d", outputIndex)
-			}
-
-			msgTx.TxOut[outputIndex] = txout
+		if err := tr.readOutputs(msgTx); err != nil {
+			return nil, bitcoin.Hash32{}, err
 		}
 
-		if err := binary.Read(r, endian, &msgTx.LockTime); err != nil {
-			return nil, errors.Wrap(err, "lock time")
+		if err := binary.Read(raw, endian, &msgTx.LockTime); err != nil {
+			return nil, bitcoin.Hash32{}, errors.Wrap(err, "lock time")
 		}
 
 		return &expanded_tx.ExpandedTx{
 			Tx: msgTx,
-		}, nil
-	}
-
-	outputCount, err := wire.ReadVarInt(r, txProtocolVersion)
-	if err != nil {
-		return nil, errors.Wrap(err, "input count")
+		}, tr.txid(), nil
 	}
 
-	if outputCount > 0 {
-		// The tx doesn't have any inputs, but isn't extended.
-		msgTx.TxOut = make([]*wire.TxOut, outputCount)
-		for outputIndex := range msgTx.TxOut {
-			txout := &wire.TxOut{}
-			if err := txout.Deserialize(r, txProtocolVersion, 0); err != nil {
-				return nil, errors.Wrapf(err, "output %d", outputIndex)
-			}
-
-			msgTx.TxOut[outputIndex] = txout
-		}
-
-		if err := binary.Read(r, endian, &msgTx.LockTime); err != nil {
-			return nil, errors.Wrap(err, "lock time")
-		}
-
-		return &expanded_tx.ExpandedTx{
-			Tx: msgTx,
-		}, nil
+	// The tx either has no inputs or is extended.
+	if err := tr.readOutputs(msgTx); err != nil {
+		return nil, bitcoin.Hash32{}, err
 	}
 
-	if err := binary.Read(r, endian, &msgTx.LockTime); err != nil {
-		return nil, errors.Wrap(err, "lock time")
+	if err := binary.Read(raw, endian, &msgTx.LockTime); err != nil {
+		return nil, bitcoin.Hash32{}, errors.Wrap(err, "lock time")
 	}
 
-	if msgTx.LockTime != MarkerLockTime {
-		// The tx has no inputs or outputs, but isn't extended.
+	if len(msgTx.TxOut) > 0 || msgTx.LockTime != MarkerLockTime {
+		// The tx has no inputs, but isn't extended.
 		return &expanded_tx.ExpandedTx{
 			Tx: msgTx,
-		}, nil
-	}
-
-	// The tx is extended and the actual input count follows.
-	count, err := wire.ReadVarInt(r, txProtocolVersion)
-	if err != nil {
-		return nil, errors.Wrap(err, "actual input count")
-	}
-	inputCount = count
-
-	spentOutputs := make(expanded_tx.Outputs, inputCount)
-	msgTx.TxIn = make([]*wire.TxIn, inputCount)
-	for inputIndex := range msgTx.TxIn {
-		input := &wire.TxIn{}
-		output := &wire.TxOut{}
-		if err := DeserializeExtendedOutput(r, input, output); err != nil {
-			return nil, errors.Wrapf(err, "input %d", inputIndex)
-		}
-
-		msgTx.TxIn[inputIndex] = input
-		spentOutputs[inputIndex] = &expanded_tx.Output{
-			Value:         output.Value,
-			LockingScript: output.LockingScript,
-		}
-	}
-
-	if err := readOutputs(r, msgTx); err != nil {
-		return nil, errors.Wrap(err, "read non extended outputs")
+		}, tr.txid(), nil
 	}
 
-	if err := binary.Read(r, endian, &msgTx.LockTime); err != nil {
-		return nil, errors.Wrap(err, "lock time")
+	// The tx is extended so the marker isn't part of the txid.
+	if err := tr.resetHash(msgTx.Version); err != nil {
+		return nil, bitcoin.Hash32{}, errors.Wrap(err, "hash version")
 	}
+	msgTx.LockTime = 0
 
-	return &expanded_tx.ExpandedTx{
-		Tx:           msgTx,
-		SpentOutputs: spentOutputs,
-	}, nil
-}
-
-func DeserializeTxID(r io.Reader) (bitcoin.Hash32, error) {
-	hasher := sha256.New()
-	tee := io.TeeReader(r, hasher)
-
-	var version int32
-	if err := binary.Read(tee, endian, &version); err != nil {
-		return bitcoin.Hash32{}, errors.Wrap(err, "version")
-	}
-
-	inputCount, err := wire.ReadVarInt(r, txProtocolVersion)
-	if err != nil {
-		return bitcoin.Hash32{}, errors.Wrap(err, "input count")
-	}
-
-	if inputCount > 0 {
-		// The tx isn't extended.
-		if err := wire.WriteVarInt(hasher, txProtocolVersion, inputCount); err != nil {
-			return bitcoin.Hash32{}, errors.Wrap(err, "write input count")
-		}
-
-		for inputIndex := uint64(0); inputIndex < inputCount; inputIndex++ {
-			txin := &wire.TxIn{}
-			if err := txin.Deserialize(tee, txProtocolVersion, 0); err != nil {
-				return bitcoin.Hash32{}, errors.Wrapf(err, "input %d", inputIndex)
-			}
-		}
-
-		outputCount, err := wire.ReadVarInt(tee, txProtocolVersion)
-		if err != nil {
-			return bitcoin.Hash32{}, errors.Wrap(err, "input count")
-		}
-
-		for outputIndex := uint64(0); outputIndex < outputCount; outputIndex++ {
-			txout := &wire.TxOut{}
-			if err := txout.Deserialize(tee, txProtocolVersion, 0); err != nil {
-				return bitcoin.Hash32{}, errors.Wrapf(err, "output %d", outputIndex)
-			}
-		}
-
-		var lockTime uint32
-		if err := binary.Read(tee, endian, &lockTime); err != nil {
-			return bitcoin.Hash32{}, errors.Wrap(err, "lock time")
-		}
-
-		return bitcoin.Hash32(sha256.Sum256(hasher.Sum(nil))), nil
-	}
-
-	outputCount, err := wire.ReadVarInt(r, txProtocolVersion)
+	// The actual input count follows.
+	inputCount, err = tr.readInputCount()
 	if err != nil {
-		return bitcoin.Hash32{}, errors.Wrap(err, "input count")
-	}
-
-	if outputCount > 0 {
-		// The tx doesn't have any inputs, but isn't extended.
-		if err := wire.WriteVarInt(hasher, txProtocolVersion, inputCount); err != nil {
-			return bitcoin.Hash32{}, errors.Wrap(err, "write input count")
-		}
-
-		if err := wire.WriteVarInt(hasher, txProtocolVersion, outputCount); err != nil {
-			return bitcoin.Hash32{}, errors.Wrap(err, "write output count")
-		}
-
-		for outputIndex := uint64(0); outputIndex < outputCount; outputIndex++ {
-			txout := &wire.TxOut{}
-			if err := txout.Deserialize(tee, txProtocolVersion, 0); err != nil {
-				return bitcoin.Hash32{}, errors.Wrapf(err, "output %d", outputIndex)
-			}
-		}
-
-		var lockTime uint32
-		if err := binary.Read(tee, endian, &lockTime); err != nil {
-			return bitcoin.Hash32{}, errors.Wrap(err, "lock time")
-		}
-
-		return bitcoin.Hash32(sha256.Sum256(hasher.Sum(nil))), nil
-	}
-
-	var lockTime uint32
-	if err := binary.Read(r, endian, &lockTime); err != nil {
-		return bitcoin.Hash32{}, errors.Wrap(err, "lock time")
-	}
-
-	if lockTime != MarkerLockTime {
-		// The tx has no inputs or outputs, but isn't extended.
-		if err := wire.WriteVarInt(hasher, txProtocolVersion, inputCount); err != nil {
-			return bitcoin.Hash32{}, errors.Wrap(err, "write input count")
-		}
-
-		if err := wire.WriteVarInt(hasher, txProtocolVersion, outputCount); err != nil {
-			return bitcoin.Hash32{}, errors.Wrap(err, "write output count")
-		}
-
-		if err := binary.Write(hasher, endian, lockTime); err != nil {
-			return bitcoin.Hash32{}, errors.Wrap(err, "lock time")
-		}
-
-		return bitcoin.Hash32(sha256.Sum256(hasher.Sum(nil))), nil
+		return nil, bitcoin.Hash32{}, errors.Wrap(err, "actual")
 	}
 
-	// The tx is extended and the actual input count follows.
-	icount, err := wire.ReadVarInt(tee, txProtocolVersion)
-	if err != nil {
-		return bitcoin.Hash32{}, errors.Wrap(err, "actual input count")
+	if inputCount == 0 {
+		// Extended format is only used for txs with inputs.
+		return nil, bitcoin.Hash32{}, errors.Wrap(ErrBadMarker, "no inputs")
 	}
-	inputCount = icount
 
+	spentOutputs := make(expanded_tx.Outputs, 0, preallocateCount(inputCount))
+	msgTx.TxIn = make([]*wire.TxIn, 0, preallocateCount(inputCount))
 	for inputIndex := uint64(0); inputIndex < inputCount; inputIndex++ {
-		input := &wire.TxIn{}
-		if err := input.Deserialize(tee, txProtocolVersion, 0); err != nil {
-			return bitcoin.Hash32{}, errors.Wrap(err, "input")
+		input, err := tr.readInput()
+		if err != nil {
+			return nil, bitcoin.Hash32{}, errors.Wrapf(err, "input %d", inputIndex)
 		}
 
-		output := &wire.TxOut{}
-		if err := output.Deserialize(r, txProtocolVersion, 0); err != nil {
-			return bitcoin.Hash32{}, errors.Wrap(err, "output")
+		// The spent output isn't part of the txid.
+		output, err := tr.readOutput(tr.extended())
+		if err != nil {
+			return nil, bitcoin.Hash32{}, errors.Wrapf(err, "input %d output", inputIndex)
 		}
-	}
 
-	ocount, err := wire.ReadVarInt(tee, txProtocolVersion)
-	if err != nil {
-		return bitcoin.Hash32{}, errors.Wrap(err, "input count")
+		msgTx.TxIn = append(msgTx.TxIn, input)
+		spentOutputs = append(spentOutputs, &expanded_tx.Output{
+			Value:         output.Value,
+			LockingScript: output.LockingScript,
+		})
 	}
-	outputCount = ocount
 
-	for outputIndex := uint64(0); outputIndex < outputCount; outputIndex++ {
-		txout := &wire.TxOut{}
-		if err := txout.Deserialize(tee, txProtocolVersion, 0); err != nil {
-			return bitcoin.Hash32{}, errors.Wrapf(err, "output %d", outputIndex)
-		}
+	if err := tr.readOutputs(msgTx); err != nil {
+		return nil, bitcoin.Hash32{}, errors.Wrap(err, "read non extended outputs")
 	}
 
-	if err := binary.Read(tee, endian, &lockTime); err != nil {
-		return bitcoin.Hash32{}, errors.Wrap(err, "lock time")
+	if err := binary.Read(raw, endian, &msgTx.LockTime); err != nil {
+		return nil, bitcoin.Hash32{}, errors.Wrap(err, "lock time")
 	}
 
-	return bitcoin.Hash32(sha256.Sum256(hasher.Sum(nil))), nil
+	return &expanded_tx.ExpandedTx{
+		Tx:           msgTx,
+		SpentOutputs: spentOutputs,
+	}, tr.txid(), nil
 }
 
 func DeserializeExtendedOutput(r io.Reader, input *wire.TxIn, output *wire.TxOut) error {
@@ -364,21 +230,16 @@ func DeserializeExtendedOutput(r io.Reader, input *wire.TxIn, output *wire.TxOut
 	return nil
 }
 
-func readOutputs(r io.Reader, msgTx *wire.MsgTx) error {
-	outputCount, err := wire.ReadVarInt(r, txProtocolVersion)
-	if err != nil {
-		return errors.Wrap(err, "input count")
+func (err MissingSpentOutputsError) Error() string {
+	inputs := make([]string, len(err.Inputs))
+	for i, input := range err.Inputs {
+		inputs[i] = fmt.Sprintf("input %d (%s)", input.Index, input.OutPoint)
 	}
 
-	msgTx.TxOut = make([]*wire.TxOut, outputCount)
-	for outputIndex := range msgTx.TxOut {
-		txout := &wire.TxOut{}
-		if err := txout.Deserialize(r, txProtocolVersion, 0); err != nil {
-			return errors.Wrapf(err, "output %d", outputIndex)
-		}
-
-		msgTx.TxOut[outputIndex] = txout
-	}
+	return fmt.Sprintf("%s : %s", ErrMissingSpentOutputs, strings.Join(inputs, ", "))
+}
 
-	return nil
+// Is makes errors.Is(err, ErrMissingSpentOutputs) true for a MissingSpentOutputsError.
+func (err MissingSpentOutputsError) Is(target error) bool {
+	return target == ErrMissingSpentOutputs
 }
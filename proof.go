@@ -0,0 +1,221 @@
+package arc
+
+import (
+	"context"
+
+	"github.com/tokenized/arc/pkg/bump"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/expanded_tx"
+	"github.com/tokenized/pkg/merkle_proof"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrHeaderNotFound     = errors.New("Header Not Found")
+	ErrMissingMerklePath  = errors.New("Missing Merkle Path")
+	ErrTxNotInMerklePath  = bump.ErrTxNotFound
+	ErrWrongBlockHeight   = errors.New("Wrong Block Height")
+	ErrMerkleRootMismatch = errors.New("Merkle Root Mismatch")
+	ErrBlockHashMismatch  = errors.New("Block Hash Mismatch")
+	ErrMissingBlockHash   = errors.New("Missing Block Hash")
+	ErrTxNotInExpandedTx  = errors.New("Tx Not In Expanded Tx")
+)
+
+// HeaderProvider provides the block headers that merkle proofs are verified against. They should
+// come from a source that is trusted independently of ARC.
+type HeaderProvider interface {
+	// GetHeader returns the header of the block at the height in the longest chain. It returns
+	// ErrHeaderNotFound when there is no block at that height.
+	GetHeader(ctx context.Context, height int) (*wire.BlockHeader, error)
+}
+
+// VerifyMerkleProof verifies that the tx is in the block at the height by computing the merkle
+// root from the BRC-74 merkle path and comparing it to the header from the header provider. When
+// the block hash isn't zero it must be the hash of that header.
+func VerifyMerkleProof(ctx context.Context, headers HeaderProvider, txid bitcoin.Hash32,
+	merklePath *string, blockHash bitcoin.Hash32, blockHeight int) error {
+
+	path, err := parseMerklePath(merklePath)
+	if err != nil {
+		return err
+	}
+
+	if path == nil {
+		return ErrMissingMerklePath
+	}
+
+	if !path.Contains(txid) {
+		return errors.Wrap(ErrTxNotInMerklePath, txid.String())
+	}
+
+	if path.BlockHeight != uint64(blockHeight) {
+		return errors.Wrapf(ErrWrongBlockHeight, "merkle path height %d, block height %d",
+			path.BlockHeight, blockHeight)
+	}
+
+	header, err := headers.GetHeader(ctx, blockHeight)
+	if err != nil {
+		return errors.Wrapf(err, "header %d", blockHeight)
+	}
+
+	if !blockHash.IsZero() {
+		headerHash := *header.BlockHash()
+		if !headerHash.Equal(&blockHash) {
+			return errors.Wrapf(ErrBlockHashMismatch, "block %s is not at height %d (%s)",
+				blockHash, blockHeight, headerHash)
+		}
+	}
+
+	root, err := path.ComputeRoot(txid)
+	if err != nil {
+		return errors.Wrap(err, "merkle root")
+	}
+
+	if !root.Equal(&header.MerkleRoot) {
+		return errors.Wrapf(ErrMerkleRootMismatch, "got %s, want %s", root, header.MerkleRoot)
+	}
+
+	return nil
+}
+
+// VerifyMerkleProof verifies the merkle path, block hash, and block height of the response
+// against the headers. See VerifyMerkleProof.
+func (r TxStatusResponse) VerifyMerkleProof(ctx context.Context, headers HeaderProvider) error {
+	return VerifyMerkleProof(ctx, headers, r.TxID, r.MerklePath, r.BlockHash, r.BlockHeight)
+}
+
+// VerifyMerkleProof verifies the merkle path, block hash, and block height of the response
+// against the headers. See VerifyMerkleProof.
+func (r TxSubmitResponse) VerifyMerkleProof(ctx context.Context, headers HeaderProvider) error {
+	return VerifyMerkleProof(ctx, headers, r.TxID, r.MerklePath, r.BlockHash, r.BlockHeight)
+}
+
+// VerifyMerkleProof verifies the merkle path, block hash, and block height of the callback
+// against the headers. See VerifyMerkleProof.
+func (c Callback) VerifyMerkleProof(ctx context.Context, headers HeaderProvider) error {
+	if c.TxID == nil {
+		return errors.Wrap(ErrTxNotInMerklePath, "missing txid")
+	}
+
+	var blockHash bitcoin.Hash32
+	if c.BlockHash != nil {
+		blockHash = *c.BlockHash
+	}
+
+	return VerifyMerkleProof(ctx, headers, *c.TxID, c.MerklePath, blockHash, c.BlockHeight)
+}
+
+// NewMerkleProof converts the BRC-74 merkle path of the tx to a merkle proof for the block.
+func NewMerkleProof(txid bitcoin.Hash32, merklePath *string,
+	blockHash bitcoin.Hash32) (*merkle_proof.MerkleProof, error) {
+
+	path, err := parseMerklePath(merklePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if path == nil {
+		return nil, ErrMissingMerklePath
+	}
+
+	if blockHash.IsZero() {
+		return nil, ErrMissingBlockHash
+	}
+
+	result, err := path.MerkleProof(txid)
+	if err != nil {
+		return nil, errors.Wrap(err, "merkle proof")
+	}
+	result.BlockHash = &blockHash
+
+	return result, nil
+}
+
+// AttachMerkleProof adds the merkle proof to the tx, or the ancestor, of the expanded tx that it
+// is for. It returns false when the tx already has a merkle proof for the same block.
+func AttachMerkleProof(etx *expanded_tx.ExpandedTx,
+	merkleProof *merkle_proof.MerkleProof) (bool, error) {
+
+	txid := merkleProof.GetTxID()
+	if txid == nil {
+		return false, merkle_proof.ErrMissingTxID
+	}
+
+	if etx.Tx != nil && etx.Tx.TxHash().Equal(txid) {
+		blockHash := merkleProof.GetBlockHash()
+		for _, mp := range etx.MerkleProofs {
+			if bh := mp.GetBlockHash(); bh != nil && blockHash != nil && bh.Equal(blockHash) {
+				return false, nil // already have this proof
+			}
+		}
+
+		etx.MerkleProofs = append(etx.MerkleProofs, merkleProof)
+		return true, nil
+	}
+
+	ancestor := etx.Ancestors.GetTx(*txid)
+	if ancestor == nil {
+		return false, errors.Wrap(ErrTxNotInExpandedTx, txid.String())
+	}
+
+	return ancestor.AddMerkleProof(merkleProof), nil
+}
+
+// MerkleProof returns the merkle proof of the tx in the response. See NewMerkleProof.
+func (r TxStatusResponse) MerkleProof() (*merkle_proof.MerkleProof, error) {
+	return NewMerkleProof(r.TxID, r.MerklePath, r.BlockHash)
+}
+
+// AttachMerkleProof adds the merkle proof of the tx in the response to the expanded tx. See
+// AttachMerkleProof.
+func (r TxStatusResponse) AttachMerkleProof(etx *expanded_tx.ExpandedTx) (bool, error) {
+	merkleProof, err := r.MerkleProof()
+	if err != nil {
+		return false, err
+	}
+
+	return AttachMerkleProof(etx, merkleProof)
+}
+
+// MerkleProof returns the merkle proof of the tx in the response. See NewMerkleProof.
+func (r TxSubmitResponse) MerkleProof() (*merkle_proof.MerkleProof, error) {
+	return NewMerkleProof(r.TxID, r.MerklePath, r.BlockHash)
+}
+
+// AttachMerkleProof adds the merkle proof of the tx in the response to the expanded tx. See
+// AttachMerkleProof.
+func (r TxSubmitResponse) AttachMerkleProof(etx *expanded_tx.ExpandedTx) (bool, error) {
+	merkleProof, err := r.MerkleProof()
+	if err != nil {
+		return false, err
+	}
+
+	return AttachMerkleProof(etx, merkleProof)
+}
+
+// MerkleProof returns the merkle proof of the tx in the callback. See NewMerkleProof.
+func (c Callback) MerkleProof() (*merkle_proof.MerkleProof, error) {
+	if c.TxID == nil {
+		return nil, errors.Wrap(ErrTxNotInMerklePath, "missing txid")
+	}
+
+	var blockHash bitcoin.Hash32
+	if c.BlockHash != nil {
+		blockHash = *c.BlockHash
+	}
+
+	return NewMerkleProof(*c.TxID, c.MerklePath, blockHash)
+}
+
+// AttachMerkleProof adds the merkle proof of the tx in the callback to the expanded tx. See
+// AttachMerkleProof.
+func (c Callback) AttachMerkleProof(etx *expanded_tx.ExpandedTx) (bool, error) {
+	merkleProof, err := c.MerkleProof()
+	if err != nil {
+		return false, err
+	}
+
+	return AttachMerkleProof(etx, merkleProof)
+}
@@ -0,0 +1,96 @@
+package arc
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// retry calls the function until it succeeds, returns an error that isn't retryable, or the
+// maximum number of attempts is reached.
+func (c HTTPClient) retry(ctx context.Context, f func() error) error {
+	maxAttempts := c.config.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= maxAttempts || !IsRetryableError(err) {
+			return err
+		}
+
+		delay := c.config.backoff(attempt)
+
+		var httpError HTTPError
+		if errors.As(err, &httpError) && httpError.RetryAfter > delay {
+			maxBackoff := c.config.MaxBackoff.Duration
+			if maxBackoff > 0 && httpError.RetryAfter > maxBackoff {
+				return err // the server wants a longer wait than the max backoff
+			}
+			delay = httpError.RetryAfter
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err // not enough time left to retry
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return convertRequestError(ctx, err, "retry wait")
+		}
+	}
+}
+
+// backoff returns the delay to wait before the retry following the specified attempt.
+func (c Config) backoff(attempt int) time.Duration {
+	delay := c.BaseBackoff.Duration
+	for i := 1; i < attempt && (c.MaxBackoff.Duration == 0 || delay < c.MaxBackoff.Duration); i++ {
+		delay *= 2
+	}
+
+	if c.MaxBackoff.Duration > 0 && delay > c.MaxBackoff.Duration {
+		delay = c.MaxBackoff.Duration
+	}
+
+	if c.Jitter > 0 && delay > 0 {
+		jitter := time.Duration(float64(delay) * c.Jitter)
+		if jitter > 0 {
+			delay = delay - jitter + time.Duration(rand.Int63n(int64(jitter)*2))
+		}
+	}
+
+	return delay
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds
+// or an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,146 @@
+package arc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tokenized/config"
+
+	"github.com/pkg/errors"
+)
+
+func testRetryConfig() Config {
+	cfg := DefaultConfig()
+	cfg.MaxAttempts = 3
+	cfg.BaseBackoff = config.NewDuration(time.Millisecond)
+	cfg.MaxBackoff = config.NewDuration(time.Millisecond * 10)
+	return cfg
+}
+
+func Test_Retry_ServiceUnavailable(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte(`{"policy":{"maxtxsizepolicy":1000}}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "", "", testRetryConfig())
+
+	policy, err := client.GetPolicy(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get policy : %s", err)
+	}
+
+	if policy.Policy.MaxTxSize != 1000 {
+		t.Fatalf("Wrong max tx size : got %d, want %d", policy.Policy.MaxTxSize, 1000)
+	}
+
+	if count != 3 {
+		t.Fatalf("Wrong attempt count : got %d, want %d", count, 3)
+	}
+}
+
+func Test_Retry_InvalidTx(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(465)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "", "", testRetryConfig())
+
+	if _, err := client.SubmitTxBytes(context.Background(), []byte{0x01}); err == nil {
+		t.Fatalf("Submit should fail")
+	} else {
+		t.Logf("Error : %s", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Wrong attempt count : got %d, want %d", count, 1)
+	}
+}
+
+func Test_Retry_RetryAfter(t *testing.T) {
+	var count int32
+	var first time.Time
+	var second time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		second = time.Now()
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	cfg := testRetryConfig()
+	cfg.MaxBackoff = config.NewDuration(time.Second * 2)
+	client := NewHTTPClient(server.URL, "", "", cfg)
+
+	if _, err := client.GetPolicy(context.Background()); err != nil {
+		t.Fatalf("Failed to get policy : %s", err)
+	}
+
+	if delay := second.Sub(first); delay < time.Second {
+		t.Fatalf("Retry-After not respected : waited %s", delay)
+	}
+}
+
+func Test_Retry_RetryAfterTooLong(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "", "", testRetryConfig())
+
+	start := time.Now()
+	_, err := client.GetPolicy(context.Background())
+	t.Logf("Error : %v", err)
+
+	var httpError HTTPError
+	if !errors.As(err, &httpError) || httpError.Status != http.StatusTooManyRequests {
+		t.Fatalf("Wrong error : got %v, want status %d", err, http.StatusTooManyRequests)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Retry-After longer than the max backoff should not wait : waited %s",
+			elapsed)
+	}
+
+	if count != 1 {
+		t.Fatalf("Wrong attempt count : got %d, want %d", count, 1)
+	}
+}
+
+func Test_Config_Backoff(t *testing.T) {
+	cfg := Config{
+		BaseBackoff: config.NewDuration(time.Second),
+		MaxBackoff:  config.NewDuration(time.Second * 5),
+	}
+
+	wants := []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 5,
+		time.Second * 5}
+	for i, want := range wants {
+		if got := cfg.backoff(i + 1); got != want {
+			t.Errorf("Wrong backoff for attempt %d : got %s, want %s", i+1, got, want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package arc
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidTransition = errors.New("Invalid Tx Status Transition")
+
+	// txStatusRanks is the position of each status in ARC's lifecycle of a tx. Txs in the orphan
+	// mempool have been accepted by a node, but not propagated to the network. Double spend
+	// attempted ranks below seen because the tx has a competitor that might be mined instead.
+	txStatusRanks = map[TxStatus]int{
+		TxStatusUnknown:              0,
+		TxStatusQueued:               1,
+		TxStatusReceived:             2,
+		TxStatusStored:               3,
+		TxStatusAnnounced:            4,
+		TxStatusRequested:            5,
+		TxStatusSent:                 6,
+		TxStatusAccepted:             7,
+		TxStatusOrphaned:             8,
+		TxStatusDoubleSpendAttempted: 9,
+		TxStatusSeen:                 10,
+		TxStatusSeenMultipleNodes:    11,
+		TxStatusMinedInStaleBlock:    12,
+		TxStatusMined:                13,
+		TxStatusConfirmed:            14,
+		TxStatusRejected:             15,
+	}
+)
+
+// Rank returns the position of the status in the lifecycle of a tx. Higher ranks are further along.
+// Statuses that aren't recognized have a rank of zero. Rejected ranks above all other statuses
+// because it is final.
+func (s TxStatus) Rank() int {
+	return txStatusRanks[s]
+}
+
+// IsTerminal returns true if no further status changes are expected for the tx.
+func (s TxStatus) IsTerminal() bool {
+	return s == TxStatusConfirmed || s == TxStatusRejected
+}
+
+// IsSuccess returns true if the tx has been propagated to the network or mined.
+func (s TxStatus) IsSuccess() bool {
+	return s == TxStatusSeen || s == TxStatusSeenMultipleNodes || s == TxStatusMined ||
+		s == TxStatusConfirmed
+}
+
+// IsFailure returns true if the tx will not be mined.
+func (s TxStatus) IsFailure() bool {
+	return s == TxStatusRejected
+}
+
+// AtLeast returns true if the tx has progressed at least as far as the target status. A failed tx
+// is only at least the failure status, so a rejected tx is never "at least seen".
+func (s TxStatus) AtLeast(target TxStatus) bool {
+	if s.IsFailure() || target.IsFailure() {
+		return s == target
+	}
+
+	return s.Rank() >= target.Rank()
+}
+
+// ValidateTransition returns ErrInvalidTransition when a tx can't move from one status to the
+// other, like a mined tx going back to seen. That indicates a reorg or a misbehaving server. A
+// mined tx can move to mined in stale block when its block is reorged out.
+func ValidateTransition(from, to TxStatus) error {
+	if from == to || from == TxStatusUnknown {
+		return nil
+	}
+
+	if from == TxStatusUnrecognized || to == TxStatusUnrecognized {
+		return nil // can't be validated
+	}
+
+	if from.IsTerminal() {
+		return errors.Wrapf(ErrInvalidTransition, "%s is final: %s -> %s", from, from, to)
+	}
+
+	if from == TxStatusMined && to == TxStatusMinedInStaleBlock {
+		return nil
+	}
+
+	if to.IsFailure() || to == TxStatusDoubleSpendAttempted {
+		if from.AtLeast(TxStatusMined) {
+			return errors.Wrapf(ErrInvalidTransition, "%s -> %s", from, to)
+		}
+		return nil
+	}
+
+	if to.Rank() < from.Rank() {
+		return errors.Wrapf(ErrInvalidTransition, "%s -> %s", from, to)
+	}
+
+	return nil
+}
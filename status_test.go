@@ -0,0 +1,186 @@
+package arc
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/pkg/errors"
+)
+
+func Test_TxStatus_AtLeast(t *testing.T) {
+	tests := []struct {
+		status TxStatus
+		target TxStatus
+		want   bool
+	}{
+		{TxStatusSeen, TxStatusSeen, true},
+		{TxStatusMined, TxStatusSeen, true},
+		{TxStatusConfirmed, TxStatusMined, true},
+		{TxStatusOrphaned, TxStatusSeen, false},
+		{TxStatusOrphaned, TxStatusAccepted, true},
+		{TxStatusStored, TxStatusSeen, false},
+		{TxStatusRejected, TxStatusSeen, false},
+		{TxStatusRejected, TxStatusRejected, true},
+		{TxStatusMined, TxStatusRejected, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status.String()+"_"+tt.target.String(), func(t *testing.T) {
+			if got := tt.status.AtLeast(tt.target); got != tt.want {
+				t.Errorf("Wrong result : got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_TxStatus_MarshalText(t *testing.T) {
+	statuses := []TxStatus{TxStatusUnknown, TxStatusStored, TxStatusSeen, TxStatusMined,
+		TxStatusRejected, TxStatusDoubleSpendAttempted, TxStatusMinedInStaleBlock,
+		TxStatusUnrecognized}
+
+	for _, status := range statuses {
+		t.Run(status.String(), func(t *testing.T) {
+			js, err := json.Marshal(status)
+			if err != nil {
+				t.Fatalf("Failed to marshal status : %s", err)
+			}
+
+			var read TxStatus
+			if err := json.Unmarshal(js, &read); err != nil {
+				t.Fatalf("Failed to unmarshal status %s : %s", js, err)
+			}
+
+			if read != status {
+				t.Errorf("Wrong status : got %s, want %s", read, status)
+			}
+		})
+	}
+}
+
+func Test_TxStatus_Lifecycle(t *testing.T) {
+	for _, status := range []TxStatus{TxStatusConfirmed, TxStatusRejected} {
+		if !status.IsTerminal() {
+			t.Errorf("%s should be terminal", status)
+		}
+	}
+
+	for _, status := range []TxStatus{TxStatusSeen, TxStatusMined, TxStatusOrphaned} {
+		if status.IsTerminal() {
+			t.Errorf("%s should not be terminal", status)
+		}
+	}
+
+	if !TxStatusMined.IsSuccess() || TxStatusOrphaned.IsSuccess() {
+		t.Errorf("Wrong success")
+	}
+
+	if !TxStatusRejected.IsFailure() || TxStatusOrphaned.IsFailure() {
+		t.Errorf("Wrong failure")
+	}
+}
+
+func Test_ValidateTransition(t *testing.T) {
+	tests := []struct {
+		from  TxStatus
+		to    TxStatus
+		valid bool
+	}{
+		{TxStatusUnknown, TxStatusMined, true},
+		{TxStatusReceived, TxStatusSeen, true},
+		{TxStatusSeen, TxStatusSeen, true},
+		{TxStatusOrphaned, TxStatusSeen, true},
+		{TxStatusSeen, TxStatusMined, true},
+		{TxStatusMined, TxStatusConfirmed, true},
+		{TxStatusSeen, TxStatusRejected, true},
+		{TxStatusMined, TxStatusSeen, false},
+		{TxStatusSeen, TxStatusStored, false},
+		{TxStatusSeen, TxStatusOrphaned, false},
+		{TxStatusMined, TxStatusRejected, false},
+		{TxStatusRejected, TxStatusSeen, false},
+		{TxStatusConfirmed, TxStatusMined, false},
+		{TxStatusSeen, TxStatusDoubleSpendAttempted, true},
+		{TxStatusDoubleSpendAttempted, TxStatusMined, true},
+		{TxStatusDoubleSpendAttempted, TxStatusRejected, true},
+		{TxStatusMined, TxStatusDoubleSpendAttempted, false},
+		{TxStatusSeen, TxStatusSeenMultipleNodes, true},
+		{TxStatusMined, TxStatusMinedInStaleBlock, true},
+		{TxStatusMinedInStaleBlock, TxStatusMined, true},
+		{TxStatusMinedInStaleBlock, TxStatusSeen, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from.String()+"_"+tt.to.String(), func(t *testing.T) {
+			err := ValidateTransition(tt.from, tt.to)
+			if tt.valid {
+				if err != nil {
+					t.Errorf("Transition should be valid : %s", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidTransition) {
+				t.Errorf("Wrong error : got %v, want %s", err, ErrInvalidTransition)
+			}
+		})
+	}
+}
+
+func Test_Callback_CompetingTxs(t *testing.T) {
+	js := `{
+		"txid": "4d76b00f29e480e0a933cef9d9ffe303d6ab919e2cdb265dd2cea41089baa85a",
+		"txStatus": "DOUBLE_SPEND_ATTEMPTED",
+		"competingTxs": ["a8bf4a5fd8f1e0e37bf4c52e6f0cdfb1dbb4e6f6aa0ab5b7a9c8e5e5ab9a0a1f"]
+	}`
+
+	callback := &Callback{}
+	if err := json.Unmarshal([]byte(js), callback); err != nil {
+		t.Fatalf("Failed to unmarshal callback : %s", err)
+	}
+
+	if callback.TxStatus == nil || *callback.TxStatus != TxStatusDoubleSpendAttempted {
+		t.Fatalf("Wrong tx status : got %v, want %s", callback.TxStatus,
+			TxStatusDoubleSpendAttempted)
+	}
+
+	if !callback.IsDoubleSpend() {
+		t.Fatalf("Callback should be a double spend")
+	}
+
+	competing := callback.CompetingTxIDs()
+	if len(competing) != 1 {
+		t.Fatalf("Wrong competing tx count : got %d, want %d", len(competing), 1)
+	}
+
+	want, _ := bitcoin.NewHash32FromStr(
+		"a8bf4a5fd8f1e0e37bf4c52e6f0cdfb1dbb4e6f6aa0ab5b7a9c8e5e5ab9a0a1f")
+	if !competing[0].Equal(want) {
+		t.Fatalf("Wrong competing txid : got %s, want %s", competing[0], want)
+	}
+
+	for _, status := range []TxStatus{TxStatusDoubleSpendAttempted, TxStatusSeenMultipleNodes,
+		TxStatusMinedInStaleBlock} {
+		var decoded TxStatus
+		if err := decoded.SetString(status.String()); err != nil {
+			t.Fatalf("Failed to set status string %s : %s", status, err)
+		}
+
+		if decoded != status {
+			t.Errorf("Wrong status : got %s, want %s", decoded, status)
+		}
+
+		// Only the name is decoded because the integer value isn't ARC's.
+		js := fmt.Sprintf(`{"txStatus": %d}`, uint32(status))
+		response := &TxStatusResponse{}
+		if err := json.Unmarshal([]byte(js), response); err != nil {
+			t.Fatalf("Failed to unmarshal response : %s", err)
+		}
+
+		if response.TxStatus != TxStatusUnrecognized {
+			t.Errorf("Wrong integer status : got %s, want %s", response.TxStatus,
+				TxStatusUnrecognized)
+		}
+	}
+}